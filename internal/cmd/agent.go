@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newAgentCommand() *cobra.Command {
+	cfg := &trace.AgentConfig{}
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Serve named spans and batch exports for the other commands over a Unix socket",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return trace.RunAgent(ctx, cfg)
+		},
+	}
+	addPushFlags(cmd.Flags(), &cfg.Batcher.Push)
+	addAgentFlag(cmd.Flags(), &cfg.Socket)
+	cmd.Flags().DurationVar(&cfg.StateTTL, "state_ttl", trace.DefaultStateTTL, "Expire the named spans left untouched for this duration, 0 to keep them")
+	cmd.Flags().IntVar(&cfg.Batcher.BatchSize, "batch_size", trace.DefaultBatchSize, "Number of spans triggering an export")
+	cmd.Flags().DurationVar(&cfg.Batcher.FlushInterval, "flush_interval", trace.DefaultFlushInterval, "Maximum delay before exporting the received spans")
+	return cmd
+}
+
+// agentValue is a flag value copied to every target.
+type agentValue []*string
+
+func (v *agentValue) String() string { return *(*v)[0] }
+func (v *agentValue) Set(s string) error {
+	for _, target := range *v {
+		*target = s
+	}
+	return nil
+}
+func (v *agentValue) Type() string { return "string" }
+
+// addAgentFlag registers the socket of the agent into target, sharing the flag
+// when already registered.
+func addAgentFlag(flags *pflag.FlagSet, target *string) {
+	if f := flags.Lookup("agent"); f != nil {
+		value := f.Value.(*agentValue)
+		*target = value.String()
+		*value = append(*value, target)
+		return
+	}
+	*target = trace.DefaultAgentSocket()
+	flags.Var(&agentValue{target}, "agent", "Unix socket of the agent, overriding COTL_AGENT_SOCKET, empty to disable it. Spans are pushed directly when exporter flags are set without it")
+}
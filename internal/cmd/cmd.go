@@ -1,11 +1,20 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/nlachfr/cotl/internal/trace"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func BuildCommand() *cobra.Command {
@@ -13,27 +22,214 @@ func BuildCommand() *cobra.Command {
 		Use: "cotl",
 	}
 	root.AddCommand(
+		newAgentCommand(),
+		newCollectorCommand(),
+		newEndCommand(),
+		newEventCommand(),
+		newExecCommand(),
+		newFlushCommand(),
+		newInspectCommand(),
 		newPushCommand(),
+		newRetryCommand(),
 		newSpanCommand(),
+		newStartCommand(),
 		newTraceparentCommand(),
 	)
 	return root
 }
 
-func MarshalSpan(s *v1.Span) (string, error) {
+type Encoding string
+
+func (e *Encoding) String() string { return string(*e) }
+func (e *Encoding) Set(s string) error {
+	switch s {
+	case string(EncodingProtoBase64), string(EncodingProtoJSON), string(EncodingJSONCompact), string(EncodingEnvelope):
+		*e = Encoding(s)
+	default:
+		return fmt.Errorf("invalid encoding: %s", s)
+	}
+	return nil
+}
+func (e *Encoding) Type() string { return "encoding" }
+
+const (
+	// EncodingProtoBase64 is the protobuf wire format, as unpadded base64.
+	EncodingProtoBase64 Encoding = "proto-base64"
+	// EncodingProtoJSON is the canonical protobuf JSON mapping, indented.
+	EncodingProtoJSON Encoding = "protojson"
+	// EncodingJSONCompact is a single line of OTLP/JSON, with hex identifiers.
+	EncodingJSONCompact Encoding = "json-compact"
+	// EncodingEnvelope is the protobuf wire format in a checksummed and
+	// optionally compressed envelope.
+	EncodingEnvelope Encoding = "envelope"
+)
+
+func addEncodingFlag(flags *pflag.FlagSet, enc *Encoding, usage string) {
+	flags.Var(enc, "encoding", usage+": proto-base64, protojson, json-compact or envelope")
+}
+
+func addOutputEncodingFlags(flags *pflag.FlagSet, enc *Encoding, compression *EnvelopeCompression) {
+	addEncodingFlag(flags, enc, "Encoding of the printed span")
+	flags.Var(compression, "envelope_compression", "Compression of the envelope encoding: none, gzip or deflate, skipped when it does not save space")
+}
+
+// detectEncoding guesses the encoding of s: JSON spans are told apart by the
+// encoding of their trace identifier, hex in OTLP/JSON and base64 otherwise.
+func detectEncoding(s string) Encoding {
+	if isEnvelope(s) {
+		return EncodingEnvelope
+	} else if !strings.HasPrefix(s, "{") {
+		return EncodingProtoBase64
+	}
+	var ids struct {
+		TraceID string `json:"traceId"`
+	}
+	if json.Unmarshal([]byte(s), &ids) == nil {
+		if id, err := hex.DecodeString(ids.TraceID); err == nil && len(id) == 16 {
+			return EncodingJSONCompact
+		}
+	}
+	return EncodingProtoJSON
+}
+
+// MarshalSpan encodes s as enc, compression only applying to envelopes.
+func MarshalSpan(s *v1.Span, enc Encoding, compression EnvelopeCompression) (string, error) {
+	switch enc {
+	case EncodingProtoJSON:
+		data, err := protojson.MarshalOptions{Multiline: true}.Marshal(s)
+		return string(addTraceFlags(data, s, "\n  ")), err
+	case EncodingJSONCompact:
+		data, err := trace.MarshalOTLPJSON(s)
+		return string(addTraceFlags(data, s, "")), err
+	}
 	if data, err := proto.Marshal(s); err != nil {
 		return "", err
+	} else if enc == EncodingEnvelope {
+		return MarshalEnvelope(data, compression)
 	} else {
 		return base64.RawStdEncoding.EncodeToString(data), nil
 	}
 }
 
-func UnmarshalSpan(s string) (*v1.Span, error) {
+// UnmarshalSpan decodes s as enc, or as its detected encoding when enc is
+// empty. Envelopes and bare base64 blobs are accepted interchangeably.
+func UnmarshalSpan(s string, enc Encoding) (*v1.Span, error) {
+	s = strings.TrimSpace(s)
+	if enc == "" {
+		enc = detectEncoding(s)
+	}
 	span := &v1.Span{}
-	if data, err := base64.RawStdEncoding.DecodeString(s); err != nil {
-		return nil, err
-	} else if err = proto.Unmarshal(data, span); err != nil {
-		return nil, err
+	switch enc {
+	case EncodingProtoJSON, EncodingJSONCompact:
+		data, flags, err := takeTraceFlags([]byte(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid span: %w", err)
+		}
+		if enc == EncodingProtoJSON {
+			if err := protojson.Unmarshal(data, span); err != nil {
+				return nil, fmt.Errorf("invalid span: protojson decoding failed: %w", err)
+			}
+		} else if err := trace.UnmarshalOTLPJSON(data, span); err != nil {
+			return nil, fmt.Errorf("invalid span: OTLP/JSON decoding failed: %w", err)
+		}
+		if flags != nil {
+			trace.SetSpanTraceFlags(span, byte(*flags))
+		}
+	default:
+		var (
+			data []byte
+			err  error
+		)
+		if isEnvelope(s) {
+			data, err = UnmarshalEnvelope(s)
+		} else if data, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			err = fmt.Errorf("invalid span: base64 decoding failed: %w", err)
+		}
+		if err != nil {
+			return nil, err
+		} else if err = proto.Unmarshal(data, span); err != nil {
+			return nil, fmt.Errorf("invalid span: protobuf decoding failed: %w", err)
+		}
 	}
 	return span, nil
 }
+
+// addTraceFlags adds the "flags" field of the OTLP span to data, the JSON
+// encoding of s, right after its opening brace and sep. The JSON mappings drop
+// the trace flags, which the vendored OTLP protocol does not know about.
+func addTraceFlags(data []byte, s *v1.Span, sep string) []byte {
+	flags, ok := trace.LookupSpanTraceFlags(s)
+	if !ok || len(data) == 0 || data[0] != '{' {
+		return data
+	}
+	colon := ":"
+	if sep != "" {
+		colon = ": "
+	}
+	field := fmt.Sprintf(`%s"flags"%s%d`, sep, colon, flags)
+	if len(bytes.TrimSpace(data[1:])) > 1 {
+		field += ","
+	}
+	return append([]byte("{"+field), data[1:]...)
+}
+
+// takeTraceFlags removes the "flags" field from data, the JSON encoding of a
+// span, returning it when present.
+func takeTraceFlags(data []byte) ([]byte, *uint32, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, nil, err
+	}
+	raw, ok := fields["flags"]
+	if !ok {
+		return data, nil, nil
+	}
+	var flags uint32
+	if err := json.Unmarshal(raw, &flags); err != nil {
+		return nil, nil, fmt.Errorf("invalid flags %s: %w", raw, err)
+	}
+	delete(fields, "flags")
+	data, err := json.Marshal(fields)
+	return data, &flags, err
+}
+
+// UnmarshalSpans decodes a stream of spans encoded as enc, or as their
+// detected encoding when enc is empty. Base64 spans are newline-delimited,
+// while JSON spans may span several lines.
+func UnmarshalSpans(r io.Reader, enc Encoding) ([]*v1.Span, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var spans []*v1.Span
+	for pos := 0; pos < len(data); {
+		if isSpace(data[pos]) {
+			pos++
+			continue
+		}
+		line := 1 + bytes.Count(data[:pos], []byte("\n"))
+		end := pos + bytes.IndexByte(data[pos:], '\n')
+		if end < pos {
+			end = len(data)
+		}
+		if data[pos] == '{' {
+			var raw json.RawMessage
+			decoder := json.NewDecoder(bytes.NewReader(data[pos:]))
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, fmt.Errorf("line %d: invalid span: %w", line, err)
+			}
+			end = pos + int(decoder.InputOffset())
+		}
+		span, err := UnmarshalSpan(string(data[pos:end]), enc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		spans = append(spans, span)
+		pos = end
+	}
+	return spans, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+func newCollectorCommand() *cobra.Command {
+	cfg := &trace.CollectorConfig{}
+	var output string
+	cmd := &cobra.Command{
+		Use:   "collector",
+		Short: "Receive OTLP spans locally and print them as OTLP JSON lines",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg.Output = os.Stdout
+			if output != "-" {
+				f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				cfg.Output = f
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return trace.Collect(ctx, cfg)
+		},
+	}
+	cmd.Flags().StringVar(&cfg.GRPCEndpoint, "grpc_endpoint", trace.DefaultCollectorGRPCEndpoint, "Address of the OTLP/gRPC receiver, empty to disable it")
+	cmd.Flags().StringVar(&cfg.HTTPEndpoint, "http_endpoint", trace.DefaultCollectorHTTPEndpoint, "Address of the OTLP/HTTP receiver, empty to disable it")
+	cmd.Flags().StringVar(&output, "output", "-", "File the received spans are appended to, - for stdout")
+	return cmd
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// A span envelope is the magic prefix and its version, a colon, then the
+// base64 of a compression byte, the CRC-32 of the uncompressed payload and
+// the payload itself: cotl1:<base64(compression | crc32 | payload)>.
+const (
+	envelopeMagic   = "cotl"
+	envelopeVersion = "1"
+	envelopeHeader  = 5
+	// Bounds the decompressed payload, as a safeguard against corrupted blobs.
+	maxEnvelopeSize = 64 << 20
+)
+
+type EnvelopeCompression string
+
+func (c *EnvelopeCompression) String() string { return string(*c) }
+func (c *EnvelopeCompression) Set(s string) error {
+	switch s {
+	case string(EnvelopeNone), string(EnvelopeGzip), string(EnvelopeDeflate):
+		*c = EnvelopeCompression(s)
+	default:
+		return fmt.Errorf("invalid envelope compression: %s", s)
+	}
+	return nil
+}
+func (c *EnvelopeCompression) Type() string { return "envelopeCompression" }
+
+const (
+	EnvelopeNone    EnvelopeCompression = "none"
+	EnvelopeGzip    EnvelopeCompression = "gzip"
+	EnvelopeDeflate EnvelopeCompression = "deflate"
+)
+
+var envelopeCompressions = []EnvelopeCompression{EnvelopeNone, EnvelopeGzip, EnvelopeDeflate}
+
+func isEnvelope(s string) bool {
+	return strings.HasPrefix(s, envelopeMagic)
+}
+
+// MarshalEnvelope wraps payload in an envelope, compressed unless that would
+// not make it smaller.
+func MarshalEnvelope(payload []byte, c EnvelopeCompression) (string, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, envelopeHeader))
+	var (
+		w   io.WriteCloser
+		err error
+	)
+	switch c {
+	case EnvelopeGzip:
+		w, err = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	case EnvelopeDeflate:
+		w, err = flate.NewWriter(&buf, flate.BestCompression)
+	}
+	if err != nil {
+		return "", err
+	}
+	if w != nil {
+		if _, err = w.Write(payload); err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	data := buf.Bytes()
+	if w == nil || len(data) >= envelopeHeader+len(payload) {
+		c, data = EnvelopeNone, append(data[:envelopeHeader], payload...)
+	}
+	for i, compression := range envelopeCompressions {
+		if compression == c {
+			data[0] = byte(i)
+		}
+	}
+	binary.BigEndian.PutUint32(data[1:envelopeHeader], crc32.ChecksumIEEE(payload))
+	return envelopeMagic + envelopeVersion + ":" + base64.RawStdEncoding.EncodeToString(data), nil
+}
+
+// UnmarshalEnvelope returns the payload of an envelope, checking its
+// integrity.
+func UnmarshalEnvelope(s string) ([]byte, error) {
+	version, encoded, ok := strings.Cut(strings.TrimPrefix(s, envelopeMagic), ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid span envelope: missing ':' after version")
+	} else if version != envelopeVersion {
+		return nil, fmt.Errorf("invalid span envelope: unsupported version %q", version)
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid span envelope: base64 decoding failed: %w", err)
+	} else if len(data) < envelopeHeader {
+		return nil, fmt.Errorf("invalid span envelope: truncated header")
+	} else if int(data[0]) >= len(envelopeCompressions) {
+		return nil, fmt.Errorf("invalid span envelope: unknown compression %d", data[0])
+	}
+	var r io.Reader = bytes.NewReader(data[envelopeHeader:])
+	switch envelopeCompressions[data[0]] {
+	case EnvelopeGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid span envelope: gzip decompression failed: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case EnvelopeDeflate:
+		fl := flate.NewReader(r)
+		defer fl.Close()
+		r = fl
+	}
+	payload, err := io.ReadAll(io.LimitReader(r, maxEnvelopeSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid span envelope: %s decompression failed: %w", envelopeCompressions[data[0]], err)
+	} else if len(payload) > maxEnvelopeSize {
+		return nil, fmt.Errorf("invalid span envelope: payload larger than %d bytes", maxEnvelopeSize)
+	}
+	if sum := binary.BigEndian.Uint32(data[1:envelopeHeader]); sum != crc32.ChecksumIEEE(payload) {
+		return nil, fmt.Errorf("invalid span envelope: checksum mismatch, the blob is corrupted")
+	}
+	return payload, nil
+}
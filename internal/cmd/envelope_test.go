@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	payloads := map[string][]byte{
+		"empty":          {},
+		"compressible":   bytes.Repeat([]byte("span"), 256),
+		"incompressible": []byte("\x0a\x10\xab\xcd"),
+	}
+	for name, payload := range payloads {
+		for _, c := range envelopeCompressions {
+			t.Run(name+"/"+string(c), func(t *testing.T) {
+				s, err := MarshalEnvelope(payload, c)
+				if err != nil {
+					t.Fatal(err)
+				} else if !isEnvelope(s) {
+					t.Fatalf("missing envelope prefix: %s", s)
+				}
+				got, err := UnmarshalEnvelope(s)
+				if err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(got, payload) {
+					t.Fatalf("want %x, got %x", payload, got)
+				}
+			})
+		}
+	}
+}
+
+func TestUnmarshalEnvelopeCorrupted(t *testing.T) {
+	valid, err := MarshalEnvelope(bytes.Repeat([]byte("span"), 256), EnvelopeGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix, encoded, _ := strings.Cut(valid, ":")
+	// corrupt applies mutate to the decoded content of the valid envelope.
+	corrupt := func(mutate func([]byte) []byte) string {
+		data, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return prefix + ":" + base64.RawStdEncoding.EncodeToString(mutate(data))
+	}
+	for _, tt := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "flipped checksum byte", input: corrupt(func(d []byte) []byte { d[1] ^= 0xff; return d }), err: "checksum mismatch"},
+		{name: "flipped payload byte", input: corrupt(func(d []byte) []byte { d[len(d)-1] ^= 0xff; return d }), err: "decompression failed"},
+		{name: "stored payload flipped", input: corrupt(func(d []byte) []byte {
+			data, _ := UnmarshalEnvelope(valid)
+			data[0] ^= 0xff
+			return append(append([]byte{0}, d[1:envelopeHeader]...), data...)
+		}), err: "checksum mismatch"},
+		{name: "unknown compression", input: corrupt(func(d []byte) []byte { d[0] = byte(len(envelopeCompressions)); return d }), err: "unknown compression"},
+		{name: "truncated header", input: corrupt(func(d []byte) []byte { return d[:envelopeHeader-1] }), err: "truncated header"},
+		{name: "unsupported version", input: "cotl2:" + encoded, err: "unsupported version"},
+		{name: "missing colon", input: "cotl1" + encoded, err: "missing ':'"},
+		{name: "invalid base64", input: prefix + ":" + encoded + "!", err: "base64 decoding failed"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnmarshalEnvelope(tt.input); err == nil {
+				t.Fatal("expected an error")
+			} else if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("want an error about %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
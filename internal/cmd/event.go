@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newEventCommand() *cobra.Command {
+	cfg := &trace.EventConfig{}
+	encoding, compression := EncodingProtoBase64, EnvelopeDeflate
+	cmd := &cobra.Command{
+		Use:   "event",
+		Short: "Add a timestamped event to your spans",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ParseFlags(args); err != nil {
+				return err
+			}
+			if cfg.SpanName == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+				input, err := io.ReadAll(bufio.NewReader(os.Stdin))
+				if err != nil {
+					return err
+				} else if cfg.Span, err = UnmarshalSpan(string(input), ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if span, err := trace.AddEvent(cmd.Context(), cfg); err != nil {
+				return err
+			} else if span == nil {
+				return nil
+			} else if s, err := MarshalSpan(span, encoding, compression); err != nil {
+				return err
+			} else {
+				fmt.Println(s)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&cfg.Name, "name", "", "The name of the event")
+	cmd.Flags().Var(&cfg.Time, "time", "The time the event occurred")
+	cmd.Flags().Var(&cfg.Attributes, "attributes", "Collection of key[:type]=value pairs, with type among string, int, double, bool and their [] arrays")
+	cmd.Flags().StringVar(&cfg.SpanName, "span", "", "Name of the open span receiving the event, instead of the span read from stdin")
+	addStateFlags(cmd.Flags(), &cfg.State)
+	addOutputEncodingFlags(cmd.Flags(), &encoding, &compression)
+	return cmd
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newExecCommand() *cobra.Command {
+	cfg := &trace.ExecConfig{Capture: trace.CaptureConfig{Mode: trace.CaptureModeEvent}}
+	cmd := &cobra.Command{
+		Use:   "exec [flags] -- command [args...]",
+		Short: "Run a command within a span and push it once completed",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg.Args = args
+			resolveAgent(cmd.Flags(), &cfg.Push)
+			code, err := trace.Exec(cmd.Context(), cfg)
+			if err != nil {
+				cmd.PrintErrln("Error:", err)
+				// A successful command whose span or logs were lost
+				// must not look like a complete success.
+				if code == 0 {
+					code = 1
+				}
+			}
+			if code != 0 {
+				os.Exit(code)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().SetInterspersed(false)
+	addSpanFlags(cmd.Flags(), &cfg.Span)
+	addPushFlags(cmd.Flags(), &cfg.Push)
+	addCaptureFlags(cmd.Flags(), &cfg.Capture)
+	addCommandFlags(cmd.Flags(), cfg)
+	return cmd
+}
+
+func addCommandFlags(flags *pflag.FlagSet, cfg *trace.ExecConfig) {
+	flags.DurationVar(&cfg.Timeout, "timeout", 0, "Terminate the command with SIGTERM once this duration elapsed")
+	flags.DurationVar(&cfg.GracePeriod, "grace_period", trace.DefaultGracePeriod, "Delay before a terminated or interrupted command is killed with SIGKILL")
+	flags.BoolVar(&cfg.ProcessTree.Enabled, "process_tree", false, "Push a child span for every descendant process of the command (Linux only)")
+	flags.DurationVar(&cfg.ProcessTree.Interval, "process_tree_interval", trace.DefaultProcessTreeInterval, "Interval at which descendant processes are polled")
+}
+
+func addCaptureFlags(flags *pflag.FlagSet, cfg *trace.CaptureConfig) {
+	flags.IntVar(&cfg.StderrLines, "capture_stderr", 0, "Number of trailing stderr lines attached to the span. The captured stderr is piped, so that the command no longer sees a terminal there")
+	flags.Var(&cfg.Stdout, "capture_stdout", "Attach the stdout lines matching this regular expression to the span. The captured stdout is piped, so that the command no longer sees a terminal there")
+	flags.Var(&cfg.Exclude, "capture_exclude", "Never attach the lines matching this regular expression, such as secrets")
+	flags.IntVar(&cfg.MaxLineSize, "capture_max_line_size", trace.DefaultCaptureMaxLineSize, "Size in bytes past which captured lines are truncated")
+	flags.IntVar(&cfg.MaxSize, "capture_max_size", trace.DefaultCaptureMaxSize, "Total size in bytes of the captured lines, the oldest being dropped first")
+	flags.Var(&cfg.Mode, "capture_as", "Attach the captured lines as span events (event) or export them as correlated OTLP log records (log)")
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+func newFlushCommand() *cobra.Command {
+	cfg := &trace.FlushConfig{}
+	cmd := &cobra.Command{
+		Use:   "flush",
+		Short: "Export the spans stored in a spool directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return trace.Flush(cmd.Context(), cfg)
+		},
+	}
+	addExporterFlags(cmd.Flags(), &cfg.Mode, &cfg.Exporter)
+	cmd.Flags().StringVar(&cfg.Spool, "spool", "", "Directory where spans are stored")
+	cmd.Flags().IntVar(&cfg.Attempts, "attempts", 5, "Maximum number of export attempts")
+	cmd.Flags().DurationVar(&cfg.Backoff, "backoff", time.Second, "Delay before the first retry, doubled after each attempt")
+	cmd.Flags().DurationVar(&cfg.MaxAge, "max_age", 7*24*time.Hour, "Discard spans spooled for longer than this duration, 0 to keep them all")
+	return cmd
+}
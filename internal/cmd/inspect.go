@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"golang.org/x/term"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type inspectFormat string
+
+func (f *inspectFormat) String() string { return string(*f) }
+func (f *inspectFormat) Set(s string) error {
+	switch s {
+	case string(inspectFormatText), string(inspectFormatJson), string(inspectFormatYaml):
+		*f = inspectFormat(s)
+	default:
+		return fmt.Errorf("invalid output format: %s", s)
+	}
+	return nil
+}
+func (f *inspectFormat) Type() string { return "outputFormat" }
+
+const (
+	inspectFormatText inspectFormat = "text"
+	inspectFormatJson inspectFormat = "json"
+	inspectFormatYaml inspectFormat = "yaml"
+)
+
+func newInspectCommand() *cobra.Command {
+	format := inspectFormatText
+	var encoding Encoding
+	cmd := &cobra.Command{
+		Use:   "inspect [span]",
+		Short: "Print a span in a human-readable form",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var input string
+			if len(args) > 0 {
+				input = args[0]
+			} else if !term.IsTerminal(int(os.Stdin.Fd())) {
+				data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+				if err != nil {
+					return err
+				}
+				input = string(data)
+			}
+			input = strings.TrimSpace(input)
+			if input == "" {
+				return fmt.Errorf("A span is required")
+			}
+			span, err := UnmarshalSpan(input, encoding)
+			if err != nil {
+				return err
+			}
+			switch format {
+			case inspectFormatJson:
+				data, err := protojson.MarshalOptions{Multiline: true}.Marshal(span)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+			case inspectFormatYaml:
+				writeSpanYaml(cmd.OutOrStdout(), span)
+			default:
+				writeSpanText(cmd.OutOrStdout(), span)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().VarP(&format, "output", "o", "Output format: text, json or yaml")
+	addEncodingFlag(cmd.Flags(), &encoding, "Encoding of the input span, detected by default")
+	return cmd
+}
+
+func formatTime(unixNano uint64) string {
+	if unixNano == 0 {
+		return "-"
+	}
+	return time.Unix(0, int64(unixNano)).UTC().Format(time.RFC3339Nano)
+}
+
+func formatDuration(span *v1.Span) string {
+	if span.StartTimeUnixNano == 0 || span.EndTimeUnixNano == 0 {
+		return "-"
+	}
+	return time.Duration(int64(span.EndTimeUnixNano) - int64(span.StartTimeUnixNano)).String()
+}
+
+func formatID(id []byte) string {
+	if len(id) == 0 {
+		return "-"
+	}
+	return hex.EncodeToString(id)
+}
+
+func formatValue(v *commonv1.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonv1.AnyValue_StringValue:
+		return strconv.Quote(v.StringValue)
+	case *commonv1.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonv1.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonv1.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonv1.AnyValue_BytesValue:
+		return hex.EncodeToString(v.BytesValue)
+	case *commonv1.AnyValue_ArrayValue:
+		values := make([]string, 0, len(v.ArrayValue.GetValues()))
+		for _, value := range v.ArrayValue.GetValues() {
+			values = append(values, formatValue(value))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case *commonv1.AnyValue_KvlistValue:
+		values := make([]string, 0, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			values = append(values, kv.Key+": "+formatValue(kv.Value))
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	default:
+		return "null"
+	}
+}
+
+func writeSpanText(w io.Writer, span *v1.Span) {
+	fmt.Fprintf(w, "Trace ID:     %s\n", formatID(span.TraceId))
+	fmt.Fprintf(w, "Span ID:      %s\n", formatID(span.SpanId))
+	fmt.Fprintf(w, "Parent ID:    %s\n", formatID(span.ParentSpanId))
+	if span.TraceState != "" {
+		fmt.Fprintf(w, "Trace state:  %s\n", span.TraceState)
+	}
+	fmt.Fprintf(w, "Name:         %s\n", span.Name)
+	fmt.Fprintf(w, "Kind:         %s\n", span.Kind)
+	fmt.Fprintf(w, "Start:        %s\n", formatTime(span.StartTimeUnixNano))
+	fmt.Fprintf(w, "End:          %s\n", formatTime(span.EndTimeUnixNano))
+	fmt.Fprintf(w, "Duration:     %s\n", formatDuration(span))
+	if span.Status.GetMessage() != "" {
+		fmt.Fprintf(w, "Status:       %s (%s)\n", span.Status.GetCode(), span.Status.GetMessage())
+	} else {
+		fmt.Fprintf(w, "Status:       %s\n", span.Status.GetCode())
+	}
+	writeAttributesText(w, "Attributes:", "  ", span.Attributes)
+	if len(span.Events) > 0 {
+		fmt.Fprintln(w, "Events:")
+		for _, event := range span.Events {
+			fmt.Fprintf(w, "  %s %s\n", formatTime(event.TimeUnixNano), event.Name)
+			writeAttributesText(w, "", "    ", event.Attributes)
+		}
+	}
+	if len(span.Links) > 0 {
+		fmt.Fprintln(w, "Links:")
+		for _, link := range span.Links {
+			fmt.Fprintf(w, "  %s-%s", formatID(link.TraceId), formatID(link.SpanId))
+			if link.TraceState != "" {
+				fmt.Fprintf(w, " (%s)", link.TraceState)
+			}
+			fmt.Fprintln(w)
+			writeAttributesText(w, "", "    ", link.Attributes)
+		}
+	}
+}
+
+func writeAttributesText(w io.Writer, title, indent string, attrs []*commonv1.KeyValue) {
+	if len(attrs) == 0 {
+		return
+	}
+	if title != "" {
+		fmt.Fprintln(w, title)
+	}
+	for _, kv := range attrs {
+		fmt.Fprintf(w, "%s%s = %s\n", indent, kv.Key, formatValue(kv.Value))
+	}
+}
+
+func writeSpanYaml(w io.Writer, span *v1.Span) {
+	fmt.Fprintf(w, "trace_id: %s\n", formatID(span.TraceId))
+	fmt.Fprintf(w, "span_id: %s\n", formatID(span.SpanId))
+	fmt.Fprintf(w, "parent_span_id: %s\n", formatID(span.ParentSpanId))
+	fmt.Fprintf(w, "trace_state: %s\n", strconv.Quote(span.TraceState))
+	fmt.Fprintf(w, "name: %s\n", strconv.Quote(span.Name))
+	fmt.Fprintf(w, "kind: %s\n", span.Kind)
+	fmt.Fprintf(w, "start_time: %s\n", formatTime(span.StartTimeUnixNano))
+	fmt.Fprintf(w, "end_time: %s\n", formatTime(span.EndTimeUnixNano))
+	fmt.Fprintf(w, "duration: %s\n", formatDuration(span))
+	fmt.Fprintln(w, "status:")
+	fmt.Fprintf(w, "  code: %s\n", span.Status.GetCode())
+	fmt.Fprintf(w, "  message: %s\n", strconv.Quote(span.Status.GetMessage()))
+	writeAttributesYaml(w, "", span.Attributes)
+	if len(span.Events) > 0 {
+		fmt.Fprintln(w, "events:")
+		for _, event := range span.Events {
+			fmt.Fprintf(w, "  - name: %s\n", strconv.Quote(event.Name))
+			fmt.Fprintf(w, "    time: %s\n", formatTime(event.TimeUnixNano))
+			writeAttributesYaml(w, "    ", event.Attributes)
+		}
+	}
+	if len(span.Links) > 0 {
+		fmt.Fprintln(w, "links:")
+		for _, link := range span.Links {
+			fmt.Fprintf(w, "  - trace_id: %s\n", formatID(link.TraceId))
+			fmt.Fprintf(w, "    span_id: %s\n", formatID(link.SpanId))
+			fmt.Fprintf(w, "    trace_state: %s\n", strconv.Quote(link.TraceState))
+			writeAttributesYaml(w, "    ", link.Attributes)
+		}
+	}
+}
+
+func writeAttributesYaml(w io.Writer, indent string, attrs []*commonv1.KeyValue) {
+	if len(attrs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%sattributes:\n", indent)
+	for _, kv := range attrs {
+		fmt.Fprintf(w, "%s  %s: %s\n", indent, strconv.Quote(kv.Key), formatValue(kv.Value))
+	}
+}
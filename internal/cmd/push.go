@@ -2,16 +2,31 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/nlachfr/cotl/internal/trace"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	"golang.org/x/term"
 )
 
 func newPushCommand() *cobra.Command {
 	cfg := &trace.PushConfig{}
+	batcher := &trace.BatcherConfig{}
+	var (
+		bundles  []string
+		follow   bool
+		encoding Encoding
+	)
 	cmd := &cobra.Command{
 		Use:   "push",
 		Short: "End and push your spans directly to the provided backend",
@@ -19,20 +34,147 @@ func newPushCommand() *cobra.Command {
 			if err := cmd.ParseFlags(args); err != nil {
 				return err
 			}
-			if !term.IsTerminal(int(os.Stdin.Fd())) {
-				input, err := io.ReadAll(bufio.NewReader(os.Stdin))
-				if err != nil {
+			if follow {
+				return nil
+			} else if !term.IsTerminal(int(os.Stdin.Fd())) {
+				if spans, err := UnmarshalSpans(os.Stdin, encoding); err != nil {
 					return err
-				} else if cfg.Span, err = UnmarshalSpan(string(input)); err != nil {
+				} else {
+					cfg.Spans = append(cfg.Spans, spans...)
+				}
+			}
+			for _, bundle := range bundles {
+				f, err := os.Open(bundle)
+				if err != nil {
 					return err
 				}
+				spans, err := UnmarshalSpans(f, encoding)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %w", bundle, err)
+				}
+				cfg.Spans = append(cfg.Spans, spans...)
 			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			resolveAgent(cmd.Flags(), cfg)
+			if follow {
+				batcher.Push = *cfg
+				return followSpans(cmd, batcher, encoding, os.Stdin)
+			}
 			return trace.Push(cmd.Context(), cfg)
 		},
 	}
-	cmd.Flags().Var(&cfg.Mode, "exporter", "Configure the exporter used")
+	addPushFlags(cmd.Flags(), cfg)
+	cmd.Flags().StringArrayVar(&bundles, "bundle", nil, "File holding newline-delimited spans to push (repeatable)")
+	addEncodingFlag(cmd.Flags(), &encoding, "Encoding of the input spans, detected by default")
+	cmd.Flags().BoolVar(&follow, "follow", false, "Keep reading spans or OTLP JSON lines from stdin until EOF, exporting them in batches")
+	cmd.Flags().IntVar(&batcher.BatchSize, "batch_size", trace.DefaultBatchSize, "Number of spans triggering an export when following stdin")
+	cmd.Flags().DurationVar(&batcher.FlushInterval, "flush_interval", trace.DefaultFlushInterval, "Maximum delay before exporting the spans read when following stdin")
+	cmd.Flags().BoolVar(&cfg.IgnoreEnv, "ignore_env_parent", false, "Do not read the parent from the TRACEPARENT and TRACESTATE environment variables")
+	// Following only reads stdin.
+	cmd.MarkFlagsMutuallyExclusive("follow", "bundle")
 	return cmd
 }
+
+// followSpans feeds a batcher with the lines of r, each holding either a span
+// or an OTLP JSON export request, until EOF or SIGINT/SIGTERM.
+func followSpans(cmd *cobra.Command, cfg *trace.BatcherConfig, enc Encoding, r io.Reader) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	batcher, err := trace.NewBatcher(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		scanErr <- scanner.Err()
+	}()
+	for line := 1; ; line++ {
+		var text string
+		select {
+		case <-ctx.Done():
+			return batcher.Close(context.Background())
+		case t, ok := <-lines:
+			if !ok {
+				return errors.Join(<-scanErr, batcher.Close(context.Background()))
+			}
+			text = strings.TrimSpace(t)
+		}
+		if text == "" {
+			continue
+		} else if isExportRequest(text) {
+			req := &coltracev1.ExportTraceServiceRequest{}
+			if err := trace.UnmarshalOTLPJSON([]byte(text), req); err != nil {
+				cmd.PrintErrf("line %d: invalid OTLP JSON: %v\n", line, err)
+			} else {
+				batcher.AddResourceSpans(req.ResourceSpans...)
+			}
+		} else if span, err := UnmarshalSpan(text, enc); err != nil {
+			cmd.PrintErrf("line %d: %v\n", line, err)
+		} else {
+			batcher.AddSpans(span)
+		}
+	}
+}
+
+// isExportRequest tells OTLP JSON export requests apart from JSON spans.
+func isExportRequest(text string) bool {
+	var req struct {
+		ResourceSpans json.RawMessage `json:"resourceSpans"`
+	}
+	return strings.HasPrefix(text, "{") && json.Unmarshal([]byte(text), &req) == nil && req.ResourceSpans != nil
+}
+
+// exporterFlags select where spans are exported, bypassing the agent unless
+// --agent is set too.
+var exporterFlags = []string{
+	"exporter", "endpoint", "url_path", "insecure", "ca_cert", "client_cert", "client_key",
+	"header", "headers_file", "compression", "export_timeout", "spool", "defer",
+}
+
+// resolveAgent disables pushing through the agent when exporter flags are
+// set but --agent is not.
+func resolveAgent(flags *pflag.FlagSet, cfg *trace.PushConfig) {
+	if flags.Changed("agent") {
+		return
+	}
+	for _, name := range exporterFlags {
+		if flags.Changed(name) {
+			cfg.Agent = ""
+			return
+		}
+	}
+}
+
+func addPushFlags(flags *pflag.FlagSet, cfg *trace.PushConfig) {
+	addExporterFlags(flags, &cfg.Mode, &cfg.Exporter)
+	flags.StringVar(&cfg.Resource.ServiceName, "service_name", "", "The logical name of the service, overriding OTEL_SERVICE_NAME")
+	flags.Var(&cfg.Resource.Attributes, "resource", "Collection of key[:type]=value pairs describing the resource, overriding OTEL_RESOURCE_ATTRIBUTES")
+	flags.StringVar(&cfg.Spool, "spool", "", "Directory where spans failing to export are stored until cotl flush")
+	flags.BoolVar(&cfg.Defer, "defer", false, "Store spans in the spool without trying to export them")
+	addAgentFlag(flags, &cfg.Agent)
+}
+
+func addExporterFlags(flags *pflag.FlagSet, mode *trace.PushMode, cfg *trace.ExporterConfig) {
+	flags.Var(mode, "exporter", "Configure the exporter used")
+	flags.StringVar(&cfg.Endpoint, "endpoint", "", "Target of the exporter, as host:port or URL, overriding OTEL_EXPORTER_OTLP_ENDPOINT")
+	flags.StringVar(&cfg.URLPath, "url_path", "", "URL path of the otlphttp exporter, defaults to /v1/traces")
+	flags.VarPF(&cfg.Insecure, "insecure", "", "Disable transport security, or enable it despite OTEL_EXPORTER_OTLP_INSECURE when false").NoOptDefVal = "true"
+	flags.StringVar(&cfg.CACert, "ca_cert", "", "Path to the PEM bundle used to verify the backend certificate")
+	flags.StringVar(&cfg.ClientCert, "client_cert", "", "Path to the PEM client certificate used for mTLS")
+	flags.StringVar(&cfg.ClientKey, "client_key", "", "Path to the PEM client private key used for mTLS")
+	flags.StringToStringVar(&cfg.Headers, "header", nil, "Header sent with every export, as key=value (repeatable)")
+	flags.StringVar(&cfg.HeadersFile, "headers_file", "", "Path to a file holding one key=value or key: value header per line")
+	flags.Var(&cfg.Compression, "compression", "Compression of the exported payloads: gzip or none")
+	flags.DurationVar(&cfg.Timeout, "export_timeout", 0, "Maximum duration of an export")
+	flags.IntVar(&cfg.MaxBatchSize, "max_batch_size", trace.DefaultMaxBatchSize, "Maximum size in bytes of an export request, larger pushes being split")
+}
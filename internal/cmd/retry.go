@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+func newRetryCommand() *cobra.Command {
+	cfg := &trace.RetryConfig{Exec: trace.ExecConfig{Capture: trace.CaptureConfig{Mode: trace.CaptureModeEvent}}}
+	cmd := &cobra.Command{
+		Use:   "retry [flags] -- command [args...]",
+		Short: "Run a command until it succeeds, within a span with a child span per attempt",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg.Exec.Args = args
+			resolveAgent(cmd.Flags(), &cfg.Exec.Push)
+			code, err := trace.Retry(cmd.Context(), cfg)
+			if err != nil {
+				cmd.PrintErrln("Error:", err)
+				// A successful command whose span or logs were lost
+				// must not look like a complete success.
+				if code == 0 {
+					code = 1
+				}
+			}
+			if code != 0 {
+				os.Exit(code)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().IntVar(&cfg.Attempts, "attempts", trace.DefaultRetryAttempts, "Maximum number of attempts")
+	cmd.Flags().DurationVar(&cfg.Backoff, "backoff", trace.DefaultRetryBackoff, "Delay before the first retry")
+	cmd.Flags().Float64Var(&cfg.BackoffFactor, "backoff_factor", trace.DefaultRetryBackoffFactor, "Factor applied to the delay after each retry, at least 1")
+	cmd.Flags().DurationVar(&cfg.MaxBackoff, "max_backoff", 0, "Maximum delay between attempts")
+	addSpanFlags(cmd.Flags(), &cfg.Exec.Span)
+	addPushFlags(cmd.Flags(), &cfg.Exec.Push)
+	addCaptureFlags(cmd.Flags(), &cfg.Exec.Capture)
+	addCommandFlags(cmd.Flags(), &cfg.Exec)
+	return cmd
+}
@@ -8,11 +8,13 @@ import (
 
 	"github.com/nlachfr/cotl/internal/trace"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"golang.org/x/term"
 )
 
 func newSpanCommand() *cobra.Command {
 	cfg := &trace.SpanConfig{}
+	encoding, compression := EncodingProtoBase64, EnvelopeDeflate
 	cmd := &cobra.Command{
 		Use:   "span",
 		Short: "Create and update your spans on the fly",
@@ -24,7 +26,7 @@ func newSpanCommand() *cobra.Command {
 				input, err := io.ReadAll(bufio.NewReader(os.Stdin))
 				if err != nil {
 					return err
-				} else if cfg.BaseSpan, err = UnmarshalSpan(string(input)); err != nil {
+				} else if cfg.BaseSpan, err = UnmarshalSpan(string(input), ""); err != nil {
 					return err
 				}
 			}
@@ -33,7 +35,7 @@ func newSpanCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if span, err := trace.NewSpan(cmd.Context(), cfg); err != nil {
 				return err
-			} else if s, err := MarshalSpan(span); err != nil {
+			} else if s, err := MarshalSpan(span, encoding, compression); err != nil {
 				return err
 			} else {
 				fmt.Println(s)
@@ -41,15 +43,32 @@ func newSpanCommand() *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().BytesHexVar(&cfg.TraceID, "trace_id", nil, "A unique identifier for a trace")
-	cmd.Flags().BytesHexVar(&cfg.SpanID, "span_id", nil, "A unique identifier for a span within a trace")
-	cmd.Flags().StringVar(&cfg.TraceState, "trace_state", "", "Extends trace_parent with vendor-specific data")
-	cmd.Flags().Var(&cfg.TraceParent, "trace_parent", "Describes the position of the incoming request in its trace graph")
-	cmd.Flags().StringVar(&cfg.Name, "name", "", "A description of a span's operation")
-	cmd.Flags().Var(&cfg.StartTime, "start_time", "Start time of the span")
-	cmd.Flags().Var(&cfg.EndTime, "end_time", "End time of the span")
-	cmd.Flags().Var(&cfg.Attributes, "attributes", "Collection of key/value pairs")
-	cmd.Flags().Var(&cfg.Status.Code, "status_code", "An optional final status for this span")
-	cmd.Flags().StringVar(&cfg.Status.Description, "status_description", "", "A description for the status of this span")
+	addSpanFlags(cmd.Flags(), cfg)
+	addOutputEncodingFlags(cmd.Flags(), &encoding, &compression)
 	return cmd
 }
+
+func addSpanFlags(flags *pflag.FlagSet, cfg *trace.SpanConfig) {
+	flags.BytesHexVar(&cfg.TraceID, "trace_id", nil, "A unique identifier for a trace")
+	flags.BytesHexVar(&cfg.SpanID, "span_id", nil, "A unique identifier for a span within a trace")
+	flags.StringVar(&cfg.TraceState, "trace_state", "", "Extends trace_parent with vendor-specific data")
+	flags.Var(&cfg.TraceParent, "trace_parent", "Describes the position of the incoming request in its trace graph")
+	flags.StringVar(&cfg.Name, "name", "", "A description of a span's operation")
+	flags.Var(&cfg.Kind, "kind", "The type of span: client, server, producer, consumer or internal")
+	flags.Var(&cfg.StartTime, "start_time", "Start time of the span, as RFC3339, Unix epoch (s, ms, us or ns), now or relative to now (-90s)")
+	flags.Var(&cfg.EndTime, "end_time", "End time of the span, as RFC3339, Unix epoch (s, ms, us or ns), now or relative to now (-90s)")
+	flags.DurationVar(&cfg.Duration, "duration", 0, "Duration of the span, deriving its end time from its start time")
+	flags.Var(&cfg.Attributes, "attributes", "Collection of key[:type]=value pairs, with type among string, int, double, bool and their [] arrays")
+	flags.Var(&cfg.Links, "link", "Link to another span, as <traceparent>[;trace_state=<tracestate>][;<attributes>] (repeatable)")
+	flags.Var(&cfg.Status.Code, "status_code", "An optional final status for this span")
+	flags.StringVar(&cfg.Status.Description, "status_description", "", "A description for the status of this span")
+	addStateFlags(flags, &cfg.State)
+	flags.BoolVar(&cfg.IgnoreEnv, "ignore_env_parent", false, "Do not read the parent from the TRACEPARENT and TRACESTATE environment variables")
+}
+
+func addStateFlags(flags *pflag.FlagSet, cfg *trace.StateConfig) {
+	flags.StringVar(&cfg.Dir, "state_dir", trace.DefaultStateDir(), "Directory holding the named spans opened by cotl start, overriding COTL_STATE_DIR")
+	flags.StringVar(&cfg.Session, "session", trace.DefaultSessionID(), "Session of the named spans, overriding COTL_SESSION. Spans only default to the open spans of an explicit session as parents (default \"default\")")
+	flags.DurationVar(&cfg.TTL, "state_ttl", trace.DefaultStateTTL, "Expire the named spans left untouched for this duration, 0 to keep them")
+	addAgentFlag(flags, &cfg.Agent)
+}
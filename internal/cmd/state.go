@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"github.com/nlachfr/cotl/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+func newStartCommand() *cobra.Command {
+	cfg := &trace.SpanConfig{}
+	cmd := &cobra.Command{
+		Use:   "start <name>",
+		Short: "Open a named span, parent of the spans created until it ends",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := trace.Start(cmd.Context(), args[0], cfg)
+			return err
+		},
+	}
+	addSpanFlags(cmd.Flags(), cfg)
+	return cmd
+}
+
+func newEndCommand() *cobra.Command {
+	cfg := &trace.EndConfig{}
+	cmd := &cobra.Command{
+		Use:   "end <name>",
+		Short: "Close a named span and push it to the provided backend",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolveAgent(cmd.Flags(), &cfg.Push)
+			_, err := trace.End(cmd.Context(), args[0], cfg)
+			return err
+		},
+	}
+	addSpanFlags(cmd.Flags(), &cfg.Span)
+	addPushFlags(cmd.Flags(), &cfg.Push)
+	return cmd
+}
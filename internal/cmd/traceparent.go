@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"bufio"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/nlachfr/cotl/internal/trace"
 	"github.com/spf13/cobra"
@@ -13,19 +16,19 @@ import (
 )
 
 func newTraceparentCommand() *cobra.Command {
-	var span *v1.Span
+	var (
+		span     *v1.Span
+		encoding Encoding
+	)
 	cmd := &cobra.Command{
 		Use:   "traceparent",
 		Short: "Generate W3C traceparent from a given span",
-		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			if err := cmd.ParseFlags(args); err != nil {
-				return err
-			}
+		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if !term.IsTerminal(int(os.Stdin.Fd())) {
 				input, err := io.ReadAll(bufio.NewReader(os.Stdin))
 				if err != nil {
 					return err
-				} else if span, err = UnmarshalSpan(string(input)); err != nil {
+				} else if span, err = UnmarshalSpan(string(input), encoding); err != nil {
 					return err
 				}
 			}
@@ -35,14 +38,82 @@ func newTraceparentCommand() *cobra.Command {
 			if span == nil {
 				return fmt.Errorf("A span is required")
 			}
-			fmt.Println((&trace.TraceParent{
-				Version:    0x00,
-				TraceID:    [16]byte(span.TraceId),
-				ParentID:   [8]byte(span.SpanId),
-				TraceFlags: 0x01,
-			}).String())
+			fmt.Println(trace.NewTraceParent(span).String())
+			return nil
+		},
+	}
+	addEncodingFlag(cmd.Flags(), &encoding, "Encoding of the input span, detected by default")
+	cmd.AddCommand(newTraceparentParseCommand())
+	return cmd
+}
+
+// traceParentFields is the JSON form of a traceparent.
+type traceParentFields struct {
+	Version    string `json:"version"`
+	TraceID    string `json:"trace_id"`
+	ParentID   string `json:"parent_id"`
+	TraceFlags string `json:"trace_flags"`
+	Sampled    bool   `json:"sampled"`
+}
+
+func newTraceparentParseCommand() *cobra.Command {
+	format := inspectFormatText
+	cmd := &cobra.Command{
+		Use:   "parse [traceparent]",
+		Short: "Validate a W3C traceparent and print its fields, read from stdin or TRACEPARENT by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var input string
+			if len(args) > 0 {
+				input = args[0]
+			} else if !term.IsTerminal(int(os.Stdin.Fd())) {
+				data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+				if err != nil {
+					return err
+				}
+				input = string(data)
+			}
+			if input = strings.TrimSpace(input); input == "" {
+				input = strings.TrimSpace(os.Getenv(trace.EnvTraceParent))
+			}
+			if input == "" {
+				return fmt.Errorf("A traceparent is required")
+			}
+			tp := &trace.TraceParent{}
+			if err := tp.Set(input); err != nil {
+				return err
+			}
+			fields := traceParentFields{
+				Version:    hex.EncodeToString([]byte{tp.Version}),
+				TraceID:    hex.EncodeToString(tp.TraceID[:]),
+				ParentID:   hex.EncodeToString(tp.ParentID[:]),
+				TraceFlags: hex.EncodeToString([]byte{tp.TraceFlags}),
+				Sampled:    tp.Sampled(),
+			}
+			w := cmd.OutOrStdout()
+			switch format {
+			case inspectFormatJson:
+				data, err := json.MarshalIndent(fields, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(w, string(data))
+			case inspectFormatYaml:
+				fmt.Fprintf(w, "version: %q\n", fields.Version)
+				fmt.Fprintf(w, "trace_id: %s\n", fields.TraceID)
+				fmt.Fprintf(w, "parent_id: %s\n", fields.ParentID)
+				fmt.Fprintf(w, "trace_flags: %q\n", fields.TraceFlags)
+				fmt.Fprintf(w, "sampled: %t\n", fields.Sampled)
+			default:
+				fmt.Fprintf(w, "Version:      %s\n", fields.Version)
+				fmt.Fprintf(w, "Trace ID:     %s\n", fields.TraceID)
+				fmt.Fprintf(w, "Parent ID:    %s\n", fields.ParentID)
+				fmt.Fprintf(w, "Trace flags:  %s\n", fields.TraceFlags)
+				fmt.Fprintf(w, "Sampled:      %t\n", fields.Sampled)
+			}
 			return nil
 		},
 	}
+	cmd.Flags().VarP(&format, "output", "o", "Output format: text, json or yaml")
 	return cmd
 }
@@ -0,0 +1,389 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	EnvAgentSocket = "COTL_AGENT_SOCKET"
+	agentSocket    = "agent.sock"
+	agentTimeout   = 5 * time.Second
+	agentDialWait  = 100 * time.Millisecond
+
+	agentTracesPath  = "/v1/traces"
+	agentSpansPath   = "/v1/spans"
+	agentCurrentPath = "/v1/current"
+	agentEventsPath  = "/v1/events"
+	agentLogsPath    = "/v1/logs"
+)
+
+// DefaultAgentSocket returns the socket of the agent, from COTL_AGENT_SOCKET
+// or else in the default state directory.
+func DefaultAgentSocket() string {
+	if socket := os.Getenv(EnvAgentSocket); socket != "" {
+		return socket
+	}
+	return filepath.Join(DefaultStateDir(), agentSocket)
+}
+
+// AgentConfig configures the agent, whose named spans expire once left
+// untouched for StateTTL.
+type AgentConfig struct {
+	Socket   string
+	Batcher  BatcherConfig
+	StateTTL time.Duration
+}
+
+// agent holds the open named spans in memory and batches the spans pushed to
+// it, exporting the log records pushed to it right away with the exporter of
+// push. It serves protobuf messages over HTTP.
+type agent struct {
+	batcher *Batcher
+	push    *PushConfig
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]map[string]*agentSpan
+	seq      uint64
+}
+
+type agentSpan struct {
+	span    *v1.Span
+	seq     uint64
+	updated time.Time
+}
+
+// RunAgent serves the agent on cfg.Socket until ctx is done, then exports the
+// pending spans.
+func RunAgent(ctx context.Context, cfg *AgentConfig) error {
+	if cfg.Socket == "" {
+		return fmt.Errorf("A socket is required")
+	}
+	if err := privateDir(filepath.Dir(cfg.Socket)); err != nil {
+		return err
+	}
+	if agent, err := dialAgent(cfg.Socket); err != nil {
+		return err
+	} else if agent != nil {
+		return fmt.Errorf("an agent is already listening on %s", cfg.Socket)
+	}
+	// Nobody listens on a leftover socket.
+	if err := os.Remove(cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lis, err := net.Listen("unix", cfg.Socket)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+	if err = os.Chmod(cfg.Socket, 0o600); err != nil {
+		return err
+	}
+	// The agent outlives the requests, so the parent is resolved by clients,
+	// and it exports the spans itself.
+	cfg.Batcher.Push.IgnoreEnv = true
+	cfg.Batcher.Push.Agent = ""
+	batcher, err := NewBatcher(ctx, &cfg.Batcher)
+	if err != nil {
+		return err
+	}
+	a := &agent{batcher: batcher, push: &cfg.Batcher.Push, ttl: cfg.StateTTL, sessions: map[string]map[string]*agentSpan{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(agentTracesPath, a.handleTraces)
+	mux.HandleFunc(agentSpansPath, a.handleSpans)
+	mux.HandleFunc(agentCurrentPath, a.handleCurrent)
+	mux.HandleFunc(agentEventsPath, a.handleEvents)
+	mux.HandleFunc(agentLogsPath, a.handleLogs)
+	srv := &http.Server{Handler: mux}
+	errs := make(chan error, 1)
+	go func() {
+		if err := srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+	srv.Shutdown(context.Background())
+	return errors.Join(err, batcher.Close(context.Background()))
+}
+
+func readMessage(w http.ResponseWriter, r *http.Request, msg proto.Message) bool {
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = proto.Unmarshal(data, msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeMessage(w http.ResponseWriter, msg proto.Message) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(data)
+}
+
+func (a *agent) handleTraces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := &v1.TracesData{}
+	if !readMessage(w, r, data) {
+		return
+	}
+	a.batcher.AddResourceSpans(data.ResourceSpans...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *agent) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := &logsv1.LogsData{}
+	if !readMessage(w, r, data) {
+		return
+	}
+	if err := exportLogs(r.Context(), a.push.Mode, &a.push.Exporter, data.ResourceLogs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *agent) handleSpans(w http.ResponseWriter, r *http.Request) {
+	session, name := r.URL.Query().Get("session"), r.URL.Query().Get("name")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	spans := a.sessions[session]
+	switch r.Method {
+	case http.MethodGet:
+		if s, ok := a.lookup(session, name); ok {
+			writeMessage(w, s.span)
+		} else {
+			http.Error(w, errNoSpan.Error(), http.StatusNotFound)
+		}
+	case http.MethodPut:
+		span := &v1.Span{}
+		if !readMessage(w, r, span) {
+			return
+		}
+		if spans == nil {
+			spans = map[string]*agentSpan{}
+			a.sessions[session] = spans
+		}
+		a.seq++
+		spans[name] = &agentSpan{span: span, seq: a.seq, updated: time.Now()}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if _, ok := spans[name]; !ok {
+			http.Error(w, errNoSpan.Error(), http.StatusNotFound)
+			return
+		}
+		delete(spans, name)
+		if len(spans) == 0 {
+			delete(a.sessions, session)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// lookup returns the open span called name in session, forgetting it once
+// expired. The caller holds a.mu.
+func (a *agent) lookup(session, name string) (*agentSpan, bool) {
+	s, ok := a.sessions[session][name]
+	if ok && a.ttl > 0 && time.Since(s.updated) > a.ttl {
+		delete(a.sessions[session], name)
+		if len(a.sessions[session]) == 0 {
+			delete(a.sessions, session)
+		}
+		return nil, false
+	}
+	return s, ok
+}
+
+func (a *agent) handleCurrent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var latest *agentSpan
+	session := r.URL.Query().Get("session")
+	for name := range a.sessions[session] {
+		if s, ok := a.lookup(session, name); ok && (latest == nil || s.seq > latest.seq) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		http.Error(w, errNoSpan.Error(), http.StatusNotFound)
+		return
+	}
+	writeMessage(w, latest.span)
+}
+
+func (a *agent) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	event := &v1.Span_Event{}
+	if !readMessage(w, r, event) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.lookup(r.URL.Query().Get("session"), r.URL.Query().Get("name"))
+	if !ok {
+		http.Error(w, errNoSpan.Error(), http.StatusNotFound)
+		return
+	}
+	s.span.Events = append(s.span.Events, event)
+	s.updated = time.Now()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// agentClient talks to the agent listening on a Unix socket. It implements
+// stateStore.
+type agentClient struct {
+	client *http.Client
+}
+
+// dialAgent returns a client for the agent listening on socket, or nil when
+// there is none. Sockets that other users could have planted are refused.
+func dialAgent(socket string) (*agentClient, error) {
+	if socket == "" {
+		return nil, nil
+	}
+	info, err := os.Lstat(socket)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if err = checkPrivateDir(filepath.Dir(socket)); err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	} else if err = checkPrivate(socket, info); err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+	conn, err := net.DialTimeout("unix", socket, agentDialWait)
+	if err != nil {
+		return nil, nil
+	}
+	conn.Close()
+	return &agentClient{client: &http.Client{
+		Timeout: agentTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}}, nil
+}
+
+func (c *agentClient) do(method, path string, query url.Values, req, resp proto.Message) error {
+	var body io.Reader
+	if req != nil {
+		data, err := proto.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	r, err := http.NewRequest(method, "http://agent"+path+"?"+query.Encode(), body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	res, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("agent: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("agent: %w", err)
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return errNoSpan
+	case res.StatusCode >= 300:
+		return fmt.Errorf("agent: %s: %s", res.Status, bytes.TrimSpace(data))
+	case resp != nil:
+		return proto.Unmarshal(data, resp)
+	}
+	return nil
+}
+
+func spanQuery(session, name string) url.Values {
+	return url.Values{"session": {session}, "name": {name}}
+}
+
+func (c *agentClient) push(rs []*v1.ResourceSpans) error {
+	return c.do(http.MethodPost, agentTracesPath, nil, &v1.TracesData{ResourceSpans: rs}, nil)
+}
+
+// pushLogs waits for the agent to export rl, which may outlast agentTimeout.
+func (c *agentClient) pushLogs(rl []*logsv1.ResourceLogs) error {
+	exporting := &agentClient{client: &http.Client{Transport: c.client.Transport}}
+	err := exporting.do(http.MethodPost, agentLogsPath, nil, &logsv1.LogsData{ResourceLogs: rl}, nil)
+	if errors.Is(err, errNoSpan) {
+		return fmt.Errorf("agent: log records are not supported, restart it")
+	}
+	return err
+}
+
+func (c *agentClient) save(session, name string, span *v1.Span) error {
+	return c.do(http.MethodPut, agentSpansPath, spanQuery(session, name), span, nil)
+}
+
+func (c *agentClient) load(session, name string) (*v1.Span, error) {
+	span := &v1.Span{}
+	if err := c.do(http.MethodGet, agentSpansPath, spanQuery(session, name), nil, span); err != nil {
+		return nil, err
+	}
+	return span, nil
+}
+
+func (c *agentClient) remove(session, name string) error {
+	return c.do(http.MethodDelete, agentSpansPath, spanQuery(session, name), nil, nil)
+}
+
+func (c *agentClient) current(session string) (*v1.Span, error) {
+	span := &v1.Span{}
+	if err := c.do(http.MethodGet, agentCurrentPath, url.Values{"session": {session}}, nil, span); err != nil {
+		return nil, err
+	}
+	return span, nil
+}
+
+func (c *agentClient) addEvent(session, name string, event *v1.Span_Event) error {
+	return c.do(http.MethodPost, agentEventsPath, spanQuery(session, name), event, nil)
+}
@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	collogsv1 "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// startAgent runs the agent configured by cfg until the end of the test, and
+// returns its socket.
+func startAgent(t *testing.T, cfg *AgentConfig) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "state", agentSocket)
+	cfg.Socket = socket
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- RunAgent(ctx, cfg)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	})
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if agent, _ := dialAgent(socket); agent != nil {
+			return socket
+		}
+	}
+	t.Fatal("the agent did not start")
+	return ""
+}
+
+func TestExecLogsThroughAgent(t *testing.T) {
+	logs := make(chan *collogsv1.ExportLogsServiceRequest, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	})
+	mux.HandleFunc("/v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		req := &collogsv1.ExportLogsServiceRequest{}
+		data, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = proto.Unmarshal(data, req)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logs <- req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	})
+	srv := httptest.NewServer(mux)
+	// Closed after the agent, which exports the span when stopped.
+	t.Cleanup(srv.Close)
+
+	// The exec itself has no exporter: the agent exports the spans and the
+	// log records.
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	socket := startAgent(t, &AgentConfig{Batcher: BatcherConfig{Push: PushConfig{Mode: PushModeOtlpHttp}}})
+	code, err := Exec(context.Background(), &ExecConfig{
+		Span: SpanConfig{IgnoreEnv: true},
+		Push: PushConfig{Agent: socket},
+		Capture: CaptureConfig{
+			StderrLines: 1,
+			MaxLineSize: DefaultCaptureMaxLineSize,
+			MaxSize:     DefaultCaptureMaxSize,
+			Mode:        CaptureModeLog,
+		},
+		Args: []string{"sh", "-c", "echo captured >&2"},
+	})
+	if err != nil || code != 0 {
+		t.Fatalf("exec failed with code %d: %v", code, err)
+	}
+	select {
+	case req := <-logs:
+		records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+		if len(records) != 1 || records[0].Body.GetStringValue() != "captured" {
+			t.Fatalf("unexpected log records: %v", records)
+		}
+	default:
+		t.Fatal("the log records were not exported")
+	}
+}
+
+func TestAgentStateTTL(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	agent, err := dialAgent(startAgent(t, &AgentConfig{Batcher: BatcherConfig{Push: PushConfig{Mode: PushModeStdout}}, StateTTL: ttl}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = agent.save("s", "build", &v1.Span{Name: "build"}); err != nil {
+		t.Fatal(err)
+	} else if _, err = agent.load("s", "build"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * ttl)
+	if _, err = agent.load("s", "build"); !errors.Is(err, errNoSpan) {
+		t.Fatalf("want the expired span to be gone, got %v", err)
+	} else if _, err = agent.current("s"); !errors.Is(err, errNoSpan) {
+		t.Fatalf("want no current span, got %v", err)
+	}
+}
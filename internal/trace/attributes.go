@@ -0,0 +1,183 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// SpanAttributes parses a comma separated list of key[:type]=value entries.
+//
+// Supported types are string (the default), int, double and bool, as well as
+// their array counterparts suffixed with []. Array elements are the following
+// comma separated tokens, up to the next key=value entry. Values can be quoted
+// with single or double quotes, or have their special characters escaped with
+// a backslash.
+type SpanAttributes struct {
+	attrs []*commonv1.KeyValue
+}
+
+func (a *SpanAttributes) String() string { return fmt.Sprintf("%v", a.attrs) }
+func (a *SpanAttributes) Set(s string) error {
+	tokens, err := tokenizeAttributes(s)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if !token.assign {
+			return fmt.Errorf("missing '=' in attribute %q", token.raw)
+		}
+		key, typ, _ := strings.Cut(token.key, ":")
+		if key == "" {
+			return fmt.Errorf("missing key in attribute %q", token.raw)
+		}
+		var value *commonv1.AnyValue
+		if elemType, ok := strings.CutSuffix(typ, "[]"); ok {
+			elems := []attributeToken{}
+			if token.value != "" || token.quoted {
+				elems = append(elems, token)
+			}
+			for ; i+1 < len(tokens) && !tokens[i+1].assign; i++ {
+				elems = append(elems, tokens[i+1])
+			}
+			array := &commonv1.ArrayValue{}
+			for _, elem := range elems {
+				v, err := parseAttributeValue(elemType, elem)
+				if err != nil {
+					return err
+				}
+				array.Values = append(array.Values, v)
+			}
+			value = &commonv1.AnyValue{Value: &commonv1.AnyValue_ArrayValue{ArrayValue: array}}
+		} else if value, err = parseAttributeValue(typ, token); err != nil {
+			return err
+		}
+		a.attrs = append(a.attrs, &commonv1.KeyValue{Key: key, Value: value})
+	}
+	return nil
+}
+func (a *SpanAttributes) Type() string { return "SpanAttributes" }
+
+// KeyValues returns the parsed attributes.
+func (a *SpanAttributes) KeyValues() []*commonv1.KeyValue { return a.attrs }
+
+func parseAttributeValue(typ string, token attributeToken) (*commonv1.AnyValue, error) {
+	switch typ {
+	case "", "string":
+		return &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: token.value}}, nil
+	case "int":
+		i, err := strconv.ParseInt(token.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int value %q in attribute %q", token.value, token.raw)
+		}
+		return &commonv1.AnyValue{Value: &commonv1.AnyValue_IntValue{IntValue: i}}, nil
+	case "double":
+		f, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double value %q in attribute %q", token.value, token.raw)
+		}
+		return &commonv1.AnyValue{Value: &commonv1.AnyValue_DoubleValue{DoubleValue: f}}, nil
+	case "bool":
+		b, err := strconv.ParseBool(token.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool value %q in attribute %q", token.value, token.raw)
+		}
+		return &commonv1.AnyValue{Value: &commonv1.AnyValue_BoolValue{BoolValue: b}}, nil
+	default:
+		return nil, fmt.Errorf("invalid type %q in attribute %q", typ, token.raw)
+	}
+}
+
+type attributeToken struct {
+	raw    string
+	key    string
+	value  string
+	assign bool
+	quoted bool
+}
+
+// tokenizeAttributes splits s on unquoted commas, unescaping every token and
+// separating its key from its value on the first unquoted '='.
+func tokenizeAttributes(s string) ([]attributeToken, error) {
+	var (
+		tokens  []attributeToken
+		token   attributeToken
+		buf     strings.Builder
+		quote   rune
+		escaped bool
+		start   int
+	)
+	flush := func(end int) error {
+		token.raw = s[start:end]
+		if quote != 0 {
+			return fmt.Errorf("unterminated quote in attribute %q", token.raw)
+		} else if escaped {
+			return fmt.Errorf("trailing backslash in attribute %q", token.raw)
+		}
+		token.value = buf.String()
+		tokens = append(tokens, token)
+		token = attributeToken{}
+		buf.Reset()
+		return nil
+	}
+	for i, r := range s {
+		switch {
+		case escaped:
+			buf.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				buf.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			token.quoted = token.assign
+		case r == '=' && !token.assign:
+			token.key = buf.String()
+			token.assign = true
+			buf.Reset()
+		case r == ',':
+			if err := flush(i); err != nil {
+				return nil, err
+			}
+			start = i + 1
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	if err := flush(len(s)); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func stringAttribute(key, value string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: value}}}
+}
+
+func intAttribute(key string, value int64) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_IntValue{IntValue: value}}}
+}
+
+func doubleAttribute(key string, value float64) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_DoubleValue{DoubleValue: value}}}
+}
+
+func boolAttribute(key string, value bool) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_BoolValue{BoolValue: value}}}
+}
+
+func stringsAttribute(key string, values []string) *commonv1.KeyValue {
+	array := &commonv1.ArrayValue{}
+	for _, value := range values {
+		array.Values = append(array.Values, &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: value}})
+	}
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_ArrayValue{ArrayValue: array}}}
+}
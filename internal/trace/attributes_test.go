@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"testing"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSpanAttributesSet(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  []*commonv1.KeyValue
+		err   bool
+	}{
+		{input: "key=value", want: []*commonv1.KeyValue{stringAttribute("key", "value")}},
+		{input: "a=1,b:int=2,c:double=1.5,d:bool=true", want: []*commonv1.KeyValue{
+			stringAttribute("a", "1"),
+			intAttribute("b", 2),
+			doubleAttribute("c", 1.5),
+			boolAttribute("d", true),
+		}},
+		{input: "key:string[]=a,b", want: []*commonv1.KeyValue{stringsAttribute("key", []string{"a", "b"})}},
+		{input: "key:string[]=a,b,other=c", want: []*commonv1.KeyValue{
+			stringsAttribute("key", []string{"a", "b"}),
+			stringAttribute("other", "c"),
+		}},
+		{input: "key:string[]=", want: []*commonv1.KeyValue{stringsAttribute("key", nil)}},
+		{input: `key:string[]=""`, want: []*commonv1.KeyValue{stringsAttribute("key", []string{""})}},
+		{input: `key:string[]="a,b",'c=d'`, want: []*commonv1.KeyValue{stringsAttribute("key", []string{"a,b", "c=d"})}},
+		{input: `key="a,b=c"`, want: []*commonv1.KeyValue{stringAttribute("key", "a,b=c")}},
+		{input: `key='a\b'`, want: []*commonv1.KeyValue{stringAttribute("key", `a\b`)}},
+		{input: `key=a\,b\=c`, want: []*commonv1.KeyValue{stringAttribute("key", "a,b=c")}},
+		{input: `key=a=b`, want: []*commonv1.KeyValue{stringAttribute("key", "a=b")}},
+		{input: `"a=b"=c`, want: []*commonv1.KeyValue{stringAttribute("a=b", "c")}},
+		{input: "key", err: true},
+		{input: "=value", err: true},
+		{input: "key:int=a", err: true},
+		{input: "key:int[]=1,a", err: true},
+		{input: "key:bytes=a", err: true},
+		{input: `key="a`, err: true},
+		{input: `key=a\`, err: true},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			attrs := &SpanAttributes{}
+			err := attrs.Set(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", attrs.KeyValues())
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got := attrs.KeyValues()
+			if len(got) != len(tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if !proto.Equal(got[i], tt.want[i]) {
+					t.Fatalf("want %v, got %v", tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
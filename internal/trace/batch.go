@@ -0,0 +1,97 @@
+package trace
+
+import (
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxBatchSize keeps export requests below the 4MiB default message
+// size limit of gRPC servers.
+const DefaultMaxBatchSize = 4<<20 - 64<<10
+
+// groupResourceSpans merges the ResourceSpans sharing the same resource, and
+// within them the ScopeSpans sharing the same scope.
+func groupResourceSpans(rs []*v1.ResourceSpans) []*v1.ResourceSpans {
+	var result []*v1.ResourceSpans
+	for _, r := range rs {
+		var target *v1.ResourceSpans
+		for _, candidate := range result {
+			if proto.Equal(candidate.Resource, r.Resource) && candidate.SchemaUrl == r.SchemaUrl {
+				target = candidate
+				break
+			}
+		}
+		if target == nil {
+			target = &v1.ResourceSpans{Resource: r.Resource, SchemaUrl: r.SchemaUrl}
+			result = append(result, target)
+		}
+		for _, scope := range r.ScopeSpans {
+			var targetScope *v1.ScopeSpans
+			for _, candidate := range target.ScopeSpans {
+				if proto.Equal(candidate.Scope, scope.Scope) && candidate.SchemaUrl == scope.SchemaUrl {
+					targetScope = candidate
+					break
+				}
+			}
+			if targetScope == nil {
+				targetScope = &v1.ScopeSpans{Scope: scope.Scope, SchemaUrl: scope.SchemaUrl}
+				target.ScopeSpans = append(target.ScopeSpans, targetScope)
+			}
+			targetScope.Spans = append(targetScope.Spans, scope.Spans...)
+		}
+	}
+	return result
+}
+
+// splitResourceSpans splits rs into batches whose encoded size stays below
+// maxSize, a span larger than maxSize being sent on its own.
+func splitResourceSpans(rs []*v1.ResourceSpans, maxSize int) [][]*v1.ResourceSpans {
+	if maxSize <= 0 {
+		return [][]*v1.ResourceSpans{rs}
+	}
+	var (
+		batches [][]*v1.ResourceSpans
+		batch   []*v1.ResourceSpans
+		size    int
+	)
+	embedded := func(n int) int { return protowire.SizeTag(1) + protowire.SizeBytes(n) }
+	for _, r := range rs {
+		var resource *v1.ResourceSpans
+		for _, scope := range r.ScopeSpans {
+			var target *v1.ScopeSpans
+			for _, span := range scope.Spans {
+				spanSize := embedded(proto.Size(span))
+				// Account for the resource and scope headers, which are
+				// repeated in every batch they appear in.
+				overhead := 0
+				if resource == nil {
+					overhead += embedded(proto.Size(&v1.ResourceSpans{Resource: r.Resource, SchemaUrl: r.SchemaUrl}))
+				}
+				if target == nil {
+					overhead += embedded(proto.Size(&v1.ScopeSpans{Scope: scope.Scope, SchemaUrl: scope.SchemaUrl}))
+				}
+				if size > 0 && size+overhead+spanSize > maxSize {
+					batches = append(batches, batch)
+					batch, size, resource, target = nil, 0, nil, nil
+					overhead = embedded(proto.Size(&v1.ResourceSpans{Resource: r.Resource, SchemaUrl: r.SchemaUrl})) +
+						embedded(proto.Size(&v1.ScopeSpans{Scope: scope.Scope, SchemaUrl: scope.SchemaUrl}))
+				}
+				if resource == nil {
+					resource = &v1.ResourceSpans{Resource: r.Resource, SchemaUrl: r.SchemaUrl}
+					batch = append(batch, resource)
+				}
+				if target == nil {
+					target = &v1.ScopeSpans{Scope: scope.Scope, SchemaUrl: scope.SchemaUrl}
+					resource.ScopeSpans = append(resource.ScopeSpans, target)
+				}
+				target.Spans = append(target.Spans, span)
+				size += overhead + spanSize
+			}
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
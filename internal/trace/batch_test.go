@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// testResourceSpans returns the spans named names within a resource and a
+// scope named name.
+func testResourceSpans(name string, names ...string) *v1.ResourceSpans {
+	scope := &v1.ScopeSpans{Scope: &commonv1.InstrumentationScope{Name: name}}
+	for _, n := range names {
+		scope.Spans = append(scope.Spans, &v1.Span{
+			TraceId: bytes.Repeat([]byte{0xab}, 16),
+			SpanId:  bytes.Repeat([]byte{0xcd}, 8),
+			Name:    n,
+		})
+	}
+	return &v1.ResourceSpans{
+		Resource:   &resourcev1.Resource{Attributes: []*commonv1.KeyValue{stringAttribute("service.name", name)}},
+		ScopeSpans: []*v1.ScopeSpans{scope},
+	}
+}
+
+// requestSize returns the encoded size of an export request holding rs.
+func requestSize(rs ...*v1.ResourceSpans) int {
+	return proto.Size(&coltracev1.ExportTraceServiceRequest{ResourceSpans: rs})
+}
+
+// describeBatches lists the spans of every batch as resource/span names.
+func describeBatches(batches [][]*v1.ResourceSpans) []string {
+	var desc []string
+	for _, batch := range batches {
+		var spans []string
+		for _, r := range batch {
+			for _, scope := range r.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans = append(spans, scope.Scope.Name+"/"+span.Name)
+				}
+			}
+		}
+		desc = append(desc, strings.Join(spans, " "))
+	}
+	return desc
+}
+
+func TestSplitResourceSpans(t *testing.T) {
+	a := testResourceSpans("a", "1", "2", "3", "4")
+	b := testResourceSpans("b", "1", "2")
+	large := testResourceSpans("c", strings.Repeat("x", 1024))
+	for _, tt := range []struct {
+		name    string
+		rs      []*v1.ResourceSpans
+		maxSize int
+		want    []string
+	}{
+		{name: "unlimited", rs: []*v1.ResourceSpans{a, b}, want: []string{"a/1 a/2 a/3 a/4 b/1 b/2"}},
+		{name: "fitting", rs: []*v1.ResourceSpans{a, b}, maxSize: requestSize(a, b), want: []string{"a/1 a/2 a/3 a/4 b/1 b/2"}},
+		{
+			name:    "pairs",
+			rs:      []*v1.ResourceSpans{a},
+			maxSize: requestSize(testResourceSpans("a", "1", "2")),
+			want:    []string{"a/1 a/2", "a/3 a/4"},
+		},
+		{
+			name:    "one per batch",
+			rs:      []*v1.ResourceSpans{a, b},
+			maxSize: requestSize(testResourceSpans("a", "1")),
+			want:    []string{"a/1", "a/2", "a/3", "a/4", "b/1", "b/2"},
+		},
+		{
+			name:    "across resources",
+			rs:      []*v1.ResourceSpans{b, a},
+			maxSize: requestSize(testResourceSpans("b", "1", "2"), testResourceSpans("a", "1")),
+			want:    []string{"b/1 b/2 a/1", "a/2 a/3 a/4"},
+		},
+		{
+			name:    "oversized span",
+			rs:      []*v1.ResourceSpans{b, large, b},
+			maxSize: requestSize(b, b),
+			want:    []string{"b/1 b/2", "c/" + strings.Repeat("x", 1024), "b/1 b/2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := splitResourceSpans(tt.rs, tt.maxSize)
+			if got := describeBatches(batches); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+			for i, batch := range batches {
+				// Only a lone span may exceed the maximum size.
+				spans := strings.Fields(describeBatches(batches[i : i+1])[0])
+				if size := requestSize(batch...); tt.maxSize > 0 && size > tt.maxSize && len(spans) > 1 {
+					t.Fatalf("batch %d of %d bytes exceeds %d bytes", i, size, tt.maxSize)
+				}
+				for _, r := range batch {
+					if !proto.Equal(r.Resource, resourceOf(tt.rs, r.ScopeSpans[0].Scope.Name)) {
+						t.Fatalf("batch %d lost the resource of scope %s", i, r.ScopeSpans[0].Scope.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func resourceOf(rs []*v1.ResourceSpans, scope string) *resourcev1.Resource {
+	for _, r := range rs {
+		if r.ScopeSpans[0].Scope.Name == scope {
+			return r.Resource
+		}
+	}
+	return nil
+}
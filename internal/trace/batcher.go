@@ -0,0 +1,205 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+)
+
+type BatcherConfig struct {
+	Push          PushConfig
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Batcher exports spans in the background through a single long-lived client,
+// as soon as BatchSize spans are pending or every FlushInterval. Failed
+// exports are written to the spool when one is configured. Like Push, the
+// batches are handed over to the agent listening on Push.Agent if any, or
+// written to the spool right away when deferred.
+type Batcher struct {
+	cfg      *BatcherConfig
+	client   otlptrace.Client
+	agent    *agentClient
+	resource *resourcev1.Resource
+	parent   *TraceParent
+	state    string
+	traces   map[string]bool
+
+	mu      sync.Mutex
+	pending []*v1.ResourceSpans
+	count   int
+	failed  int
+	lastErr error
+
+	exportMu sync.Mutex
+	full     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewBatcher(ctx context.Context, cfg *BatcherConfig) (*Batcher, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	resource, err := NewResource(&cfg.Push.Resource)
+	if err != nil {
+		return nil, err
+	}
+	agent, err := dialAgent(cfg.Push.Agent)
+	if err != nil {
+		return nil, err
+	}
+	var client otlptrace.Client
+	if agent == nil && !cfg.deferred() {
+		exporter := cfg.Push.Exporter
+		if cfg.Push.Spool != "" {
+			// Failed batches are spooled instead of retried, so that they do
+			// not hold back the next ones.
+			exporter.DisableRetry = true
+		}
+		if client, err = newClient(cfg.Push.Mode, &exporter); err != nil {
+			return nil, err
+		}
+		if err = client.Start(ctx); err != nil {
+			return nil, err
+		}
+	}
+	b := &Batcher{
+		cfg:      cfg,
+		client:   client,
+		agent:    agent,
+		resource: resource,
+		traces:   map[string]bool{},
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if !cfg.Push.IgnoreEnv {
+		b.parent, b.state, _ = TraceParentFromEnv()
+	}
+	go b.run()
+	return b, nil
+}
+
+// deferred tells whether the spans are only written to the spool.
+func (c *BatcherConfig) deferred() bool {
+	return c.Push.Defer && c.Push.Spool != ""
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		b.Flush(context.Background())
+	}
+}
+
+// AddSpans queues spans, wrapped in the resource of the batcher.
+func (b *Batcher) AddSpans(spans ...*v1.Span) {
+	if len(spans) == 0 {
+		return
+	}
+	b.mu.Lock()
+	if b.parent != nil {
+		adoptParent(spans, b.parent, b.state, b.traces)
+	}
+	b.mu.Unlock()
+	b.AddResourceSpans(&v1.ResourceSpans{
+		Resource: b.resource,
+		ScopeSpans: []*v1.ScopeSpans{{
+			Scope: &commonv1.InstrumentationScope{Name: ScopeName},
+			Spans: spans,
+		}},
+	})
+}
+
+// AddResourceSpans queues rs as is.
+func (b *Batcher) AddResourceSpans(rs ...*v1.ResourceSpans) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range rs {
+		for _, scope := range r.ScopeSpans {
+			b.count += len(scope.Spans)
+		}
+	}
+	b.pending = append(b.pending, rs...)
+	if b.count >= b.cfg.BatchSize {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush exports the pending spans right away.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.exportMu.Lock()
+	defer b.exportMu.Unlock()
+	b.mu.Lock()
+	rs := b.pending
+	b.pending, b.count = nil, 0
+	b.mu.Unlock()
+	if len(rs) == 0 {
+		return nil
+	}
+	var err error
+	deferred := b.agent == nil && b.client == nil
+	if b.agent != nil {
+		err = b.agent.push(rs)
+	} else if !deferred {
+		err = uploadWith(ctx, b.client, &b.cfg.Push.Exporter, rs)
+	}
+	if (deferred || err != nil) && b.cfg.Push.Spool != "" {
+		exportErr := err
+		if err = (&Spool{Dir: b.cfg.Push.Spool}).Write(rs); err == nil && exportErr != nil {
+			warnSpooled(b.cfg.Push.Spool, exportErr)
+		}
+	}
+	if err != nil {
+		b.mu.Lock()
+		b.failed++
+		b.lastErr = err
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// Close exports the pending spans and releases the client, reporting any
+// export that failed during the lifetime of the batcher.
+func (b *Batcher) Close(ctx context.Context) error {
+	close(b.stop)
+	<-b.done
+	b.Flush(ctx)
+	var stopErr error
+	if b.client != nil {
+		stopErr = b.client.Stop(ctx)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failed > 0 {
+		return fmt.Errorf("%d exports failed, last error: %w", b.failed, b.lastErr)
+	}
+	return stopErr
+}
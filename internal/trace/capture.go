@@ -0,0 +1,244 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	DefaultCaptureMaxLineSize = 1024
+	DefaultCaptureMaxSize     = 16 << 10
+
+	// EventLog names the span events holding captured output lines.
+	EventLog            = "log"
+	AttributeIOStream   = "log.iostream"
+	AttributeLogMessage = "log.record.original"
+)
+
+type CaptureMode string
+
+func (m *CaptureMode) String() string { return string(*m) }
+func (m *CaptureMode) Set(s string) error {
+	switch s {
+	case string(CaptureModeEvent), string(CaptureModeLog):
+		*m = CaptureMode(s)
+	default:
+		return fmt.Errorf("invalid capture mode: %s", s)
+	}
+	return nil
+}
+func (m *CaptureMode) Type() string { return "captureMode" }
+
+const (
+	CaptureModeEvent CaptureMode = "event"
+	CaptureModeLog   CaptureMode = "log"
+)
+
+// Pattern is a regular expression flag, nil until set.
+type Pattern struct {
+	*regexp.Regexp
+}
+
+func (p *Pattern) String() string {
+	if p.Regexp == nil {
+		return ""
+	}
+	return p.Regexp.String()
+}
+func (p *Pattern) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	p.Regexp = re
+	return nil
+}
+func (p *Pattern) Type() string { return "regexp" }
+
+// CaptureConfig selects the output lines of a wrapped command attached to its
+// span: the last StderrLines lines of stderr and the stdout lines matching
+// Stdout, except those matching Exclude. Lines are truncated to MaxLineSize
+// bytes, and only the most recent ones fitting in MaxSize bytes are kept.
+type CaptureConfig struct {
+	StderrLines int
+	Stdout      Pattern
+	Exclude     Pattern
+	MaxLineSize int
+	MaxSize     int
+	Mode        CaptureMode
+}
+
+func (c *CaptureConfig) enabled() bool {
+	return c.StderrLines > 0 || c.Stdout.Regexp != nil
+}
+
+type capturedLine struct {
+	time   uint64
+	stream string
+	text   string
+}
+
+// outputCapture records the lines written to the streams of a command.
+type outputCapture struct {
+	cfg *CaptureConfig
+
+	mu      sync.Mutex
+	lines   []capturedLine
+	size    int
+	stderr  int
+	dropped int
+}
+
+func newOutputCapture(cfg *CaptureConfig) *outputCapture {
+	if cfg.MaxLineSize <= 0 {
+		cfg.MaxLineSize = DefaultCaptureMaxLineSize
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultCaptureMaxSize
+	}
+	return &outputCapture{cfg: cfg}
+}
+
+// add records a complete line, evicting the oldest lines past the limits.
+func (c *outputCapture) add(stream string, line []byte) {
+	if stream == "stdout" && (c.cfg.Stdout.Regexp == nil || !c.cfg.Stdout.Match(line)) {
+		return
+	} else if c.cfg.Exclude.Regexp != nil && c.cfg.Exclude.Match(line) {
+		return
+	}
+	text := truncateUTF8(validUTF8(string(line)), c.cfg.MaxLineSize)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, capturedLine{time: uint64(time.Now().UnixNano()), stream: stream, text: text})
+	// Newlines count, so that empty lines are bounded too.
+	c.size += len(text) + 1
+	if stream == "stderr" {
+		if c.stderr++; c.stderr > c.cfg.StderrLines {
+			for i := range c.lines {
+				if c.lines[i].stream == "stderr" {
+					c.remove(i)
+					break
+				}
+			}
+		}
+	}
+	for c.size > c.cfg.MaxSize {
+		c.remove(0)
+	}
+}
+
+// validUTF8 replaces the invalid UTF-8 sequences of s, which protobuf strings
+// cannot hold.
+func validUTF8(s string) string {
+	return strings.ToValidUTF8(s, string(utf8.RuneError))
+}
+
+// truncateUTF8 truncates s to at most n bytes, without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (c *outputCapture) remove(i int) {
+	if c.lines[i].stream == "stderr" {
+		c.stderr--
+	}
+	c.size -= len(c.lines[i].text) + 1
+	c.lines = append(c.lines[:i], c.lines[i+1:]...)
+	c.dropped++
+}
+
+// writer returns the io.Writer splitting the output of stream into lines.
+func (c *outputCapture) writer(stream string) *lineWriter {
+	return &lineWriter{stream: stream, capture: c}
+}
+
+// events returns the captured lines as span events.
+func (c *outputCapture) events() []*v1.Span_Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events := make([]*v1.Span_Event, 0, len(c.lines))
+	for _, l := range c.lines {
+		events = append(events, &v1.Span_Event{
+			TimeUnixNano: l.time,
+			Name:         EventLog,
+			Attributes: []*commonv1.KeyValue{
+				stringAttribute(AttributeIOStream, l.stream),
+				stringAttribute(AttributeLogMessage, l.text),
+			},
+		})
+	}
+	return events
+}
+
+// logRecords returns the captured lines as log records correlated to span.
+func (c *outputCapture) logRecords(span *v1.Span) []*logsv1.LogRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := make([]*logsv1.LogRecord, 0, len(c.lines))
+	for _, l := range c.lines {
+		severity := logsv1.SeverityNumber_SEVERITY_NUMBER_INFO
+		if l.stream == "stderr" {
+			severity = logsv1.SeverityNumber_SEVERITY_NUMBER_ERROR
+		}
+		records = append(records, &logsv1.LogRecord{
+			TimeUnixNano:         l.time,
+			ObservedTimeUnixNano: l.time,
+			SeverityNumber:       severity,
+			Body:                 &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: l.text}},
+			Attributes:           []*commonv1.KeyValue{stringAttribute(AttributeIOStream, l.stream)},
+			TraceId:              span.TraceId,
+			SpanId:               span.SpanId,
+			Flags:                uint32(SpanTraceFlags(span)),
+		})
+	}
+	return records
+}
+
+// lineWriter feeds an outputCapture with the complete lines written to it.
+type lineWriter struct {
+	stream  string
+	capture *outputCapture
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	data := append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.capture.add(w.stream, bytes.TrimSuffix(data[:i], []byte("\r")))
+		data = data[i+1:]
+	}
+	// Bound the pending line: its tail would be truncated anyway.
+	if len(data) > w.capture.cfg.MaxLineSize {
+		data = data[:w.capture.cfg.MaxLineSize]
+	}
+	w.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// Close records the last line when not terminated by a newline.
+func (w *lineWriter) Close() error {
+	if len(w.partial) > 0 {
+		w.capture.add(w.stream, w.partial)
+		w.partial = nil
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultCollectorGRPCEndpoint = "localhost:4317"
+	DefaultCollectorHTTPEndpoint = "localhost:4318"
+	DefaultTracesPath            = "/v1/traces"
+)
+
+type CollectorConfig struct {
+	GRPCEndpoint string
+	HTTPEndpoint string
+	Output       io.Writer
+}
+
+// collector receives OTLP export requests and writes them as OTLP/JSON lines.
+type collector struct {
+	coltracev1.UnimplementedTraceServiceServer
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (c *collector) write(req *coltracev1.ExportTraceServiceRequest) error {
+	data, err := MarshalOTLPJSON(req)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.out.Write(append(data, '\n'))
+	return err
+}
+
+func (c *collector) Export(_ context.Context, req *coltracev1.ExportTraceServiceRequest) (*coltracev1.ExportTraceServiceResponse, error) {
+	if err := c.write(req); err != nil {
+		return nil, err
+	}
+	return &coltracev1.ExportTraceServiceResponse{}, nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Parameters such as charset do not matter, and are not echoed back.
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid content type: %v", err), http.StatusUnsupportedMediaType)
+		return
+	}
+	req := &coltracev1.ExportTraceServiceRequest{}
+	switch contentType {
+	case "application/x-protobuf":
+		err = proto.Unmarshal(data, req)
+	case "application/json":
+		err = UnmarshalOTLPJSON(data, req)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content type: %s", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = c.write(req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var resp []byte
+	if contentType == "application/json" {
+		resp, err = MarshalOTLPJSON(&coltracev1.ExportTraceServiceResponse{})
+	} else {
+		resp, err = proto.Marshal(&coltracev1.ExportTraceServiceResponse{})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// Collect serves the OTLP gRPC and HTTP endpoints until ctx is done. An empty
+// endpoint disables the matching protocol.
+func Collect(ctx context.Context, cfg *CollectorConfig) error {
+	if cfg.GRPCEndpoint == "" && cfg.HTTPEndpoint == "" {
+		return fmt.Errorf("An endpoint is required")
+	}
+	c := &collector{out: cfg.Output}
+	errs := make(chan error, 2)
+	if cfg.GRPCEndpoint != "" {
+		lis, err := net.Listen("tcp", cfg.GRPCEndpoint)
+		if err != nil {
+			return err
+		}
+		srv := grpc.NewServer()
+		coltracev1.RegisterTraceServiceServer(srv, c)
+		go func() {
+			errs <- srv.Serve(lis)
+		}()
+		defer srv.GracefulStop()
+	}
+	if cfg.HTTPEndpoint != "" {
+		lis, err := net.Listen("tcp", cfg.HTTPEndpoint)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle(DefaultTracesPath, c)
+		srv := &http.Server{Handler: mux}
+		go func() {
+			if err := srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}()
+		defer srv.Shutdown(context.Background())
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
@@ -0,0 +1,42 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type EventConfig struct {
+	Name       string
+	Time       SpanTime
+	Attributes SpanAttributes
+	Span       *v1.Span
+	SpanName   string
+	State      StateConfig
+}
+
+// AddEvent appends a new event to cfg.Span, timestamped now unless specified.
+// When cfg.SpanName is set, the event is appended to that open span instead,
+// and no span is returned.
+func AddEvent(ctx context.Context, cfg *EventConfig) (*v1.Span, error) {
+	if cfg.Span == nil && cfg.SpanName == "" {
+		return nil, fmt.Errorf("A span is required")
+	} else if cfg.Name == "" {
+		return nil, fmt.Errorf("An event name is required")
+	}
+	event := &v1.Span_Event{
+		TimeUnixNano: cfg.Time.unixTime,
+		Name:         cfg.Name,
+		Attributes:   cfg.Attributes.KeyValues(),
+	}
+	if event.TimeUnixNano == 0 {
+		event.TimeUnixNano = uint64(time.Now().UnixNano())
+	}
+	if cfg.SpanName != "" {
+		return nil, cfg.State.addEvent(cfg.SpanName, event)
+	}
+	cfg.Span.Events = append(cfg.Span.Events, event)
+	return cfg.Span, nil
+}
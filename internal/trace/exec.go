@@ -0,0 +1,323 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	AttributeExitCode   = "process.exit.code"
+	AttributeExitSignal = "process.exit.signal"
+	AttributeTimedOut   = "process.timed_out"
+	AttributeCancelled  = "process.cancelled"
+
+	AttributePID              = "process.pid"
+	AttributeParentPID        = "process.parent_pid"
+	AttributeExecutableName   = "process.executable.name"
+	AttributeExecutablePath   = "process.executable.path"
+	AttributeCommand          = "process.command"
+	AttributeCommandArgs      = "process.command_args"
+	AttributeCommandLine      = "process.command_line"
+	AttributeWorkingDirectory = "process.working_directory"
+
+	// Resource usage, with CPU times in seconds and memory in bytes.
+	AttributeCPUUserTime         = "process.cpu.time.user"
+	AttributeCPUSystemTime       = "process.cpu.time.system"
+	AttributeMaxRSS              = "process.memory.max_rss"
+	AttributeMinorFaults         = "process.paging.faults.minor"
+	AttributeMajorFaults         = "process.paging.faults.major"
+	AttributeVoluntarySwitches   = "process.context_switches.voluntary"
+	AttributeInvoluntarySwitches = "process.context_switches.involuntary"
+	AttributeDiskReads           = "process.disk.operations.read"
+	AttributeDiskWrites          = "process.disk.operations.write"
+
+	DefaultGracePeriod = 10 * time.Second
+)
+
+type ExecConfig struct {
+	Span        SpanConfig
+	Push        PushConfig
+	Capture     CaptureConfig
+	ProcessTree ProcessTreeConfig
+	// Timeout, when set, terminates the command once elapsed. A terminated
+	// command is killed if it is still running after GracePeriod, which also
+	// bounds the wait for the output of descendants outliving the command.
+	Timeout     time.Duration
+	GracePeriod time.Duration
+	Args        []string
+}
+
+// Exec runs cfg.Args within a new span and pushes it once the command has
+// exited. The returned code mirrors the one of the child, using the shell
+// convention 128+n when it was killed by signal n. The output selected by
+// cfg.Capture is attached to the span, or exported as log records after it.
+// With cfg.ProcessTree, the descendants of the command are pushed as child
+// spans. SIGINT and SIGTERM are forwarded to the command, and the span is
+// pushed even when the command was cancelled or timed out.
+func Exec(ctx context.Context, cfg *ExecConfig) (int, error) {
+	span, signals, err := startExecution(ctx, cfg)
+	if err != nil {
+		return 1, err
+	}
+	// Signals stay caught until the span was pushed.
+	defer signal.Stop(signals)
+	run := runCommand(ctx, span, cfg, signals)
+	if cfg.Span.Status.Code == StatusCodeUnset {
+		span.Status = run.status
+	}
+	err = pushExecution(ctx, &cfg.Push, append([]*v1.Span{span}, run.spans...), run.records)
+	return run.code, errors.Join(run.err, err)
+}
+
+// startExecution returns the span wrapping cfg.Args, named after the command
+// by default, and starts catching SIGINT and SIGTERM on the returned channel
+// so that runCommand forwards them. Callers stop it once done.
+func startExecution(ctx context.Context, cfg *ExecConfig) (*v1.Span, chan os.Signal, error) {
+	if len(cfg.Args) == 0 {
+		return nil, nil, fmt.Errorf("A command is required")
+	}
+	span, err := NewSpan(ctx, &cfg.Span)
+	if err != nil {
+		return nil, nil, err
+	}
+	if span.Name == "" {
+		span.Name = cfg.Args[0]
+	}
+	if cfg.ProcessTree.Enabled {
+		// Fail before running anything on unsupported platforms.
+		if _, err := listProcesses(); err != nil {
+			return nil, nil, err
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	return span, signals, nil
+}
+
+// commandRun is the result of runCommand.
+type commandRun struct {
+	code    int
+	outcome runOutcome
+	status  *v1.Status
+	// spans holds the process tree of the command.
+	spans   []*v1.Span
+	records []*logsv1.LogRecord
+	err     error
+}
+
+// runCommand runs cfg.Args within span, which it ends and describes. The
+// status of the command is returned rather than set on span.
+func runCommand(ctx context.Context, span *v1.Span, cfg *ExecConfig, signals <-chan os.Signal) *commandRun {
+	cmd := exec.CommandContext(ctx, cfg.Args[0], cfg.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	span.Attributes = append(span.Attributes, processAttributes(cmd)...)
+	var (
+		capture *outputCapture
+		writers []*lineWriter
+	)
+	// Only the captured streams are piped through cotl: the others keep the
+	// file descriptors of cotl, terminal included.
+	if cfg.Capture.enabled() {
+		capture = newOutputCapture(&cfg.Capture)
+		if cfg.Capture.Stdout.Regexp != nil {
+			w := capture.writer("stdout")
+			cmd.Stdout, writers = io.MultiWriter(os.Stdout, w), append(writers, w)
+		}
+		if cfg.Capture.StderrLines > 0 {
+			w := capture.writer("stderr")
+			cmd.Stderr, writers = io.MultiWriter(os.Stderr, w), append(writers, w)
+		}
+	}
+	cmd.Env = append(os.Environ(), "TRACEPARENT="+NewTraceParent(span).String())
+	if span.TraceState != "" {
+		cmd.Env = append(cmd.Env, "TRACESTATE="+span.TraceState)
+	}
+
+	run := &commandRun{}
+	var tree *processTree
+	cmd.WaitDelay = cfg.gracePeriod()
+	restoreTerminal := setProcessGroup(cmd)
+	runErr := cmd.Start()
+	if runErr == nil {
+		if cfg.ProcessTree.Enabled {
+			tree, runErr = startProcessTree(cmd.Process.Pid, &cfg.ProcessTree)
+		}
+		var waitErr error
+		run.outcome, waitErr = wait(cmd, cfg, signals)
+		if runErr == nil {
+			runErr = waitErr
+		}
+		restoreTerminal()
+	}
+	span.EndTimeUnixNano = uint64(time.Now().UnixNano())
+	if tree != nil {
+		tree.Stop()
+		run.spans = tree.spans(span)
+	}
+	for _, w := range writers {
+		w.Close()
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.As(runErr, &exitErr), errors.Is(runErr, exec.ErrWaitDelay):
+		runErr = nil
+	case errors.Is(runErr, exec.ErrNotFound):
+		run.code = 127
+	default:
+		run.code = 126
+	}
+	if state := cmd.ProcessState; state != nil {
+		span.Attributes = append(span.Attributes,
+			intAttribute(AttributePID, int64(state.Pid())),
+			doubleAttribute(AttributeCPUUserTime, state.UserTime().Seconds()),
+			doubleAttribute(AttributeCPUSystemTime, state.SystemTime().Seconds()),
+		)
+		span.Attributes = append(span.Attributes, rusageAttributes(state)...)
+		run.code = state.ExitCode()
+		if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			run.code = 128 + int(status.Signal())
+			span.Attributes = append(span.Attributes, stringAttribute(AttributeExitSignal, status.Signal().String()))
+		}
+	}
+	span.Attributes = append(span.Attributes, intAttribute(AttributeExitCode, int64(run.code)))
+	if run.outcome.timedOut {
+		span.Attributes = append(span.Attributes, boolAttribute(AttributeTimedOut, true))
+	}
+	if run.outcome.signal != nil {
+		span.Attributes = append(span.Attributes, boolAttribute(AttributeCancelled, true))
+	}
+	run.err = runErr
+	run.status = &v1.Status{Code: v1.Status_STATUS_CODE_OK}
+	if runErr != nil {
+		run.status = &v1.Status{Code: v1.Status_STATUS_CODE_ERROR, Message: runErr.Error()}
+	} else if run.outcome.timedOut {
+		run.status = &v1.Status{Code: v1.Status_STATUS_CODE_ERROR, Message: fmt.Sprintf("timed out after %s", cfg.Timeout)}
+	} else if run.outcome.signal != nil {
+		run.status = &v1.Status{Code: v1.Status_STATUS_CODE_ERROR, Message: fmt.Sprintf("cancelled: %s", run.outcome.signal)}
+	} else if run.code != 0 {
+		run.status = &v1.Status{Code: v1.Status_STATUS_CODE_ERROR, Message: cmd.ProcessState.String()}
+	}
+
+	if capture != nil && cfg.Capture.Mode == CaptureModeLog {
+		run.records = capture.logRecords(span)
+	} else if capture != nil {
+		span.Events = append(span.Events, capture.events()...)
+		span.DroppedEventsCount += uint32(capture.dropped)
+	}
+	return run
+}
+
+// pushExecution pushes the spans of wrapped commands, then the log records
+// captured from their output. Both go through the agent when one listens on
+// cfg.Agent, or else through the exporter of cfg.
+func pushExecution(ctx context.Context, cfg *PushConfig, spans []*v1.Span, records []*logsv1.LogRecord) error {
+	cfg.Spans = spans
+	// The parent was already resolved by NewSpan.
+	cfg.IgnoreEnv = true
+	agent, err := dialAgent(cfg.Agent)
+	if err != nil {
+		return err
+	}
+	err = push(ctx, cfg, agent)
+	if len(records) > 0 {
+		resource, resErr := NewResource(&cfg.Resource)
+		if resErr == nil && agent != nil {
+			resErr = agent.pushLogs(newResourceLogs(resource, records))
+		} else if resErr == nil {
+			resErr = exportLogs(ctx, cfg.Mode, &cfg.Exporter, newResourceLogs(resource, records))
+		}
+		err = errors.Join(err, resErr)
+	}
+	return err
+}
+
+func (c *ExecConfig) gracePeriod() time.Duration {
+	if c.GracePeriod <= 0 {
+		return DefaultGracePeriod
+	}
+	return c.GracePeriod
+}
+
+// runOutcome tells why a command was terminated, if it was.
+type runOutcome struct {
+	timedOut bool
+	signal   os.Signal
+}
+
+// wait waits for the started cmd to exit, forwarding SIGINT and SIGTERM to its
+// process group and terminating it once cfg.Timeout elapsed. A group still
+// running cfg.GracePeriod after either is killed.
+func wait(cmd *exec.Cmd, cfg *ExecConfig, signals <-chan os.Signal) (runOutcome, error) {
+	var timeout, kill <-chan time.Time
+	if cfg.Timeout > 0 {
+		timer := time.NewTimer(cfg.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var outcome runOutcome
+	for {
+		select {
+		case err := <-exited:
+			return outcome, err
+		case sig := <-signals:
+			outcome.signal = sig
+			if err := signalGroup(cmd.Process, sig); err != nil {
+				cmd.Process.Kill()
+			}
+		case <-timeout:
+			outcome.timedOut = true
+			// Not every platform can deliver SIGTERM.
+			if err := signalGroup(cmd.Process, syscall.SIGTERM); err != nil {
+				cmd.Process.Kill()
+			}
+		case <-kill:
+			if err := signalGroup(cmd.Process, os.Kill); err != nil {
+				cmd.Process.Kill()
+			}
+			continue
+		}
+		if kill == nil {
+			kill = time.After(cfg.gracePeriod())
+		}
+	}
+}
+
+// processAttributes describes the process about to be started by cmd.
+// Paths and arguments are made valid UTF-8, as protobuf strings must be.
+func processAttributes(cmd *exec.Cmd) []*commonv1.KeyValue {
+	path := validUTF8(cmd.Path)
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		args[i] = validUTF8(arg)
+	}
+	attrs := []*commonv1.KeyValue{
+		intAttribute(AttributeParentPID, int64(os.Getpid())),
+		stringAttribute(AttributeExecutableName, filepath.Base(path)),
+		stringAttribute(AttributeExecutablePath, path),
+		stringAttribute(AttributeCommand, args[0]),
+		stringsAttribute(AttributeCommandArgs, args),
+		stringAttribute(AttributeCommandLine, strings.Join(args, " ")),
+	}
+	if dir, err := os.Getwd(); err == nil {
+		attrs = append(attrs, stringAttribute(AttributeWorkingDirectory, validUTF8(dir)))
+	}
+	return attrs
+}
@@ -0,0 +1,277 @@
+package trace
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"google.golang.org/grpc/credentials"
+)
+
+type Compression string
+
+func (c *Compression) String() string { return string(*c) }
+func (c *Compression) Set(s string) error {
+	switch s {
+	case string(CompressionNone), string(CompressionGzip):
+		*c = Compression(s)
+	default:
+		return fmt.Errorf("invalid compression: %s", s)
+	}
+	return nil
+}
+func (c *Compression) Type() string { return "compression" }
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+)
+
+// OptionalBool is a boolean flag telling false apart from unset, so that
+// false may override the environment.
+type OptionalBool struct {
+	value, set bool
+}
+
+func (b *OptionalBool) String() string { return strconv.FormatBool(b.value) }
+func (b *OptionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean: %s", s)
+	}
+	b.value, b.set = v, true
+	return nil
+}
+func (b *OptionalBool) Type() string { return "bool" }
+
+// Get returns the value of b and whether it was set.
+func (b OptionalBool) Get() (value bool, set bool) { return b.value, b.set }
+
+// ExporterConfig holds the OTLP connection settings. Every field left to its
+// zero value falls back to the matching OTEL_EXPORTER_OTLP_* variable.
+type ExporterConfig struct {
+	Endpoint     string
+	URLPath      string
+	Insecure     OptionalBool
+	CACert       string
+	ClientCert   string
+	ClientKey    string
+	Headers      map[string]string
+	HeadersFile  string
+	Compression  Compression
+	Timeout      time.Duration
+	MaxBatchSize int
+
+	DisableRetry bool
+}
+
+// endpoint splits the configured endpoint, which may either be a host:port
+// pair or a full URL.
+func (c *ExporterConfig) endpoint() (host string, path string, insecure bool, err error) {
+	if !strings.Contains(c.Endpoint, "://") {
+		return c.Endpoint, c.URLPath, c.Insecure.value, nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	path = c.URLPath
+	if path == "" && u.Path != "" && u.Path != "/" {
+		path = u.Path
+	}
+	return u.Host, path, c.Insecure.value || u.Scheme == "http", nil
+}
+
+// secure tells whether transport security was explicitly required.
+func (c *ExporterConfig) secure() bool {
+	insecure, set := c.Insecure.Get()
+	return set && !insecure
+}
+
+// compressionEnv tells whether the environment configures the compression of
+// the exporters.
+func compressionEnv() bool {
+	return os.Getenv(envExporterPrefix+"COMPRESSION") != "" || os.Getenv(envExporterPrefix+"TRACES_COMPRESSION") != ""
+}
+
+// insecureEnv returns the variable which disables the transport security of
+// the exporters, if any, the last one set taking precedence.
+func insecureEnv() string {
+	var name string
+	for _, env := range []string{envExporterEndpoint, envTracesEndpoint} {
+		if value := os.Getenv(env); value != "" {
+			if u, err := url.Parse(value); err == nil && (u.Scheme == "http" || u.Scheme == "unix") {
+				name = env
+			} else {
+				name = ""
+			}
+		}
+	}
+	for _, env := range []string{envExporterInsecure, envTracesInsecure} {
+		if insecure, err := strconv.ParseBool(os.Getenv(env)); err != nil {
+			continue
+		} else if insecure {
+			name = env
+		} else {
+			name = ""
+		}
+	}
+	return name
+}
+
+func (c *ExporterConfig) maxBatchSize() int {
+	if c.MaxBatchSize == 0 {
+		return DefaultMaxBatchSize
+	}
+	return c.MaxBatchSize
+}
+
+func (c *ExporterConfig) headers() (map[string]string, error) {
+	headers := map[string]string{}
+	if c.HeadersFile != "" {
+		f, err := os.Open(c.HeadersFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if k, v, found := strings.Cut(line, ":"); found && (!ok || len(k) < len(key)) {
+				key, value, ok = k, v, found
+			}
+			if !ok || strings.TrimSpace(key) == "" {
+				return nil, fmt.Errorf("invalid header in %s: %q", c.HeadersFile, line)
+			}
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range c.Headers {
+		headers[key] = value
+	}
+	return headers, nil
+}
+
+func (c *ExporterConfig) tlsConfig() (*tls.Config, error) {
+	if c.CACert == "" && c.ClientCert == "" && c.ClientKey == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{}
+	if c.CACert != "" {
+		data, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CACert)
+		}
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (c *ExporterConfig) grpcOptions() ([]otlptracegrpc.Option, error) {
+	var opts []otlptracegrpc.Option
+	host, _, insecure, err := c.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(host))
+	}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if headers, err := c.headers(); err != nil {
+		return nil, err
+	} else if len(headers) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(headers))
+	}
+	cfg, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	} else if cfg == nil && !insecure && c.secure() {
+		// Credentials take precedence over OTEL_EXPORTER_OTLP_INSECURE.
+		cfg = &tls.Config{}
+	}
+	if cfg != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg)))
+	}
+	// The gRPC exporter only knows about gzip: it logs other compressors
+	// before falling back to no compression, which is only needed to
+	// override the environment.
+	if c.Compression == CompressionGzip || c.Compression == CompressionNone && compressionEnv() {
+		opts = append(opts, otlptracegrpc.WithCompressor(string(c.Compression)))
+	}
+	if c.Timeout != 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(c.Timeout))
+	}
+	if c.DisableRetry {
+		opts = append(opts, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{Enabled: false}))
+	}
+	return opts, nil
+}
+
+func (c *ExporterConfig) httpOptions() ([]otlptracehttp.Option, error) {
+	var opts []otlptracehttp.Option
+	host, path, insecure, err := c.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(host))
+	}
+	if path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(path))
+	}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else if env := insecureEnv(); env != "" && c.secure() {
+		return nil, fmt.Errorf("the otlphttp exporter cannot enable transport security disabled by %s", env)
+	}
+	if headers, err := c.headers(); err != nil {
+		return nil, err
+	} else if len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+	if cfg, err := c.tlsConfig(); err != nil {
+		return nil, err
+	} else if cfg != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(cfg))
+	}
+	switch c.Compression {
+	case CompressionGzip:
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	case CompressionNone:
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.NoCompression))
+	}
+	if c.Timeout != 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(c.Timeout))
+	}
+	if c.DisableRetry {
+		opts = append(opts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}))
+	}
+	return opts, nil
+}
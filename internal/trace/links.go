@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// SpanLinks parses <traceparent>[;trace_state=<tracestate>][;<attributes>]
+// values, one link per value. Attributes follow the SpanAttributes syntax.
+type SpanLinks struct {
+	links []*v1.Span_Link
+}
+
+func (l *SpanLinks) String() string { return fmt.Sprintf("%v", l.links) }
+func (l *SpanLinks) Set(s string) error {
+	parts := splitLink(s)
+	tp := &TraceParent{}
+	if err := tp.Set(parts[0]); err != nil {
+		return fmt.Errorf("invalid link %q: %w", s, err)
+	}
+	link := &v1.Span_Link{
+		TraceId: tp.TraceID[:],
+		SpanId:  tp.ParentID[:],
+	}
+	attrs := &SpanAttributes{}
+	for _, part := range parts[1:] {
+		if state, ok := strings.CutPrefix(part, "trace_state="); ok {
+			link.TraceState = state
+		} else if err := attrs.Set(part); err != nil {
+			return fmt.Errorf("invalid link %q: %w", s, err)
+		}
+	}
+	link.Attributes = attrs.KeyValues()
+	l.links = append(l.links, link)
+	return nil
+}
+func (l *SpanLinks) Type() string { return "SpanLinks" }
+
+// splitLink splits s on semicolons, unless quoted or escaped.
+func splitLink(s string) []string {
+	var (
+		parts   []string
+		quote   rune
+		escaped bool
+		start   int
+	)
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ';':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
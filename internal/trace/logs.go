@@ -0,0 +1,273 @@
+package trace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	collogsv1 "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultLogsPath     = "/v1/logs"
+	defaultLogsTimeout  = 10 * time.Second
+	envLogsEndpoint     = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
+	envExporterEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envExporterInsecure = "OTEL_EXPORTER_OTLP_INSECURE"
+	envTracesEndpoint   = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	envTracesInsecure   = "OTEL_EXPORTER_OTLP_TRACES_INSECURE"
+	envExporterPrefix   = "OTEL_EXPORTER_OTLP_"
+	envLogsPrefix       = "OTEL_EXPORTER_OTLP_LOGS_"
+)
+
+// The OTLP trace exporters do not handle logs, so they are exported by hand.
+// Unset settings fall back to the OTEL_EXPORTER_OTLP_LOGS_* variables, then
+// to the OTEL_EXPORTER_OTLP_* ones, and failed exports are not retried.
+
+// logsEnv returns the logs specific variable for setting, or the generic one.
+func logsEnv(setting string) string {
+	if value, ok := os.LookupEnv(envLogsPrefix + setting); ok {
+		return value
+	}
+	return os.Getenv(envExporterPrefix + setting)
+}
+
+// logsEndpoint resolves the target of the logs exporter, defaulting to
+// defaultHost. Only OTEL_EXPORTER_OTLP_LOGS_ENDPOINT is used as is: the path
+// of other endpoints, which target traces, is replaced by DefaultLogsPath.
+func (c *ExporterConfig) logsEndpoint(defaultHost string) (host string, path string, insecure bool, err error) {
+	cfg := *c
+	cfg.URLPath = ""
+	switch {
+	case cfg.Endpoint != "":
+		host, _, insecure, err = cfg.endpoint()
+	case os.Getenv(envLogsEndpoint) != "":
+		cfg.Endpoint = os.Getenv(envLogsEndpoint)
+		host, path, insecure, err = cfg.endpoint()
+	default:
+		cfg.Endpoint = os.Getenv(envExporterEndpoint)
+		host, _, insecure, err = cfg.endpoint()
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	if host == "" {
+		host = defaultHost
+	}
+	if path == "" {
+		path = DefaultLogsPath
+	}
+	if env, _ := strconv.ParseBool(logsEnv("INSECURE")); env && !c.secure() {
+		insecure = true
+	}
+	return host, path, insecure, nil
+}
+
+// logsHeaders merges the configured headers with the ones of
+// OTEL_EXPORTER_OTLP_LOGS_HEADERS and OTEL_EXPORTER_OTLP_HEADERS.
+func (c *ExporterConfig) logsHeaders() (map[string]string, error) {
+	headers, err := c.headers()
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range []string{envLogsPrefix + "HEADERS", envExporterPrefix + "HEADERS"} {
+		for _, pair := range strings.Split(os.Getenv(env), ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			key, err1 := url.QueryUnescape(strings.TrimSpace(key))
+			value, err2 := url.QueryUnescape(strings.TrimSpace(value))
+			if _, set := headers[key]; err1 == nil && err2 == nil && !set {
+				headers[key] = value
+			}
+		}
+	}
+	return headers, nil
+}
+
+func (c *ExporterConfig) logsCompression() (Compression, error) {
+	if c.Compression != "" {
+		return c.Compression, nil
+	}
+	var compression Compression
+	if env := logsEnv("COMPRESSION"); env != "" {
+		if err := compression.Set(env); err != nil {
+			return "", err
+		}
+	}
+	return compression, nil
+}
+
+// logsTimeout returns the configured timeout, the variables holding a number
+// of milliseconds.
+func (c *ExporterConfig) logsTimeout() (time.Duration, error) {
+	if c.Timeout != 0 {
+		return c.Timeout, nil
+	}
+	if env := logsEnv("TIMEOUT"); env != "" {
+		ms, err := strconv.Atoi(env)
+		if err != nil || ms < 0 {
+			return 0, fmt.Errorf("invalid logs export timeout: %s", env)
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return defaultLogsTimeout, nil
+}
+
+// newResourceLogs wraps records in resource.
+func newResourceLogs(resource *resourcev1.Resource, records []*logsv1.LogRecord) []*logsv1.ResourceLogs {
+	return []*logsv1.ResourceLogs{{
+		Resource: resource,
+		ScopeLogs: []*logsv1.ScopeLogs{{
+			Scope:      &commonv1.InstrumentationScope{Name: ScopeName},
+			LogRecords: records,
+		}},
+	}}
+}
+
+// exportLogs exports rl through the protocol matching mode.
+func exportLogs(ctx context.Context, mode PushMode, exporter *ExporterConfig, rl []*logsv1.ResourceLogs) error {
+	if len(rl) == 0 {
+		return nil
+	}
+	req := &collogsv1.ExportLogsServiceRequest{ResourceLogs: rl}
+	switch mode {
+	case PushModeStdout:
+		data, err := MarshalOTLPJSON(req)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(data))
+		return err
+	case PushModeOtlp:
+		return exportLogsGRPC(ctx, exporter, req)
+	case PushModeOtlpHttp:
+		return exportLogsHTTP(ctx, exporter, req)
+	default:
+		return fmt.Errorf("invalid push mode: %s", mode)
+	}
+}
+
+func exportLogsGRPC(ctx context.Context, exporter *ExporterConfig, req *collogsv1.ExportLogsServiceRequest) error {
+	host, _, insecureConn, err := exporter.logsEndpoint(DefaultCollectorGRPCEndpoint)
+	if err != nil {
+		return err
+	}
+	creds := insecure.NewCredentials()
+	if !insecureConn {
+		cfg, err := exporter.tlsConfig()
+		if err != nil {
+			return err
+		} else if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		creds = credentials.NewTLS(cfg)
+	}
+	headers, err := exporter.logsHeaders()
+	if err != nil {
+		return err
+	}
+	compression, err := exporter.logsCompression()
+	if err != nil {
+		return err
+	}
+	timeout, err := exporter.logsTimeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, metadata.New(headers)), timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var opts []grpc.CallOption
+	if compression == CompressionGzip {
+		opts = append(opts, grpc.UseCompressor(string(CompressionGzip)))
+	}
+	_, err = collogsv1.NewLogsServiceClient(conn).Export(ctx, req, opts...)
+	return err
+}
+
+func exportLogsHTTP(ctx context.Context, exporter *ExporterConfig, req *collogsv1.ExportLogsServiceRequest) error {
+	host, path, insecureConn, err := exporter.logsEndpoint(DefaultCollectorHTTPEndpoint)
+	if err != nil {
+		return err
+	}
+	compression, err := exporter.logsCompression()
+	if err != nil {
+		return err
+	}
+	timeout, err := exporter.logsTimeout()
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if compression == CompressionGzip {
+		gz := gzip.NewWriter(&body)
+		gz.Write(data)
+		if err = gz.Close(); err != nil {
+			return err
+		}
+	} else {
+		body.Write(data)
+	}
+	scheme := "https"
+	if insecureConn {
+		scheme = "http"
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+host+path, &body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	if compression == CompressionGzip {
+		r.Header.Set("Content-Encoding", "gzip")
+	}
+	headers, err := exporter.logsHeaders()
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig, err = exporter.tlsConfig(); err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("logs export failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
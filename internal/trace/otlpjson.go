@@ -0,0 +1,81 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP/JSON departs from the canonical protobuf JSON mapping: identifiers are
+// hex encoded instead of base64, and enums are encoded as integers.
+var otlpIDFields = map[string]bool{
+	"traceId":      true,
+	"spanId":       true,
+	"parentSpanId": true,
+}
+
+// MarshalOTLPJSON encodes m as a single line of OTLP/JSON.
+func MarshalOTLPJSON(m proto.Message) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return convertOTLPIDs(data, func(s string) (string, error) {
+		id, err := base64.StdEncoding.DecodeString(s)
+		return hex.EncodeToString(id), err
+	})
+}
+
+// UnmarshalOTLPJSON decodes OTLP/JSON data into m.
+func UnmarshalOTLPJSON(data []byte, m proto.Message) error {
+	data, err := convertOTLPIDs(data, func(s string) (string, error) {
+		id, err := hex.DecodeString(s)
+		return base64.StdEncoding.EncodeToString(id), err
+	})
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+func convertOTLPIDs(data []byte, convert func(string) (string, error)) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree any
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	var walk func(any) error
+	walk = func(node any) error {
+		switch node := node.(type) {
+		case map[string]any:
+			for key, value := range node {
+				if s, ok := value.(string); ok && otlpIDFields[key] {
+					id, err := convert(s)
+					if err != nil {
+						return fmt.Errorf("invalid %s %q: %w", key, s, err)
+					}
+					node[key] = id
+				} else if err := walk(value); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, value := range node {
+				if err := walk(value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(tree); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
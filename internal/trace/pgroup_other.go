@@ -0,0 +1,19 @@
+//go:build !unix
+
+package trace
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Process groups are a Unix concept: elsewhere, only the command itself is
+// signaled.
+
+func setProcessGroup(cmd *exec.Cmd) func() {
+	return func() {}
+}
+
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package trace
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// setProcessGroup starts cmd in its own process group, so that signals reach
+// its descendants too. When we are in the foreground of the terminal, the
+// group of cmd takes it over so that the command stays interactive, and the
+// returned function moves it back once the command exited.
+func setProcessGroup(cmd *exec.Cmd) func() {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	tty, ok := cmd.Stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(tty.Fd())) {
+		return func() {}
+	}
+	fd := int(tty.Fd())
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || pgrp != syscall.Getpgrp() {
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground, cmd.SysProcAttr.Ctty = true, fd
+	return func() {
+		// Background processes are stopped when changing the terminal.
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, pgrp)
+	}
+}
+
+// signalGroup sends sig to the process group led by p.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid, s)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package trace
+
+import "io/fs"
+
+// checkPrivate trusts the ACLs of the platform, file modes being Unix ones.
+func checkPrivate(path string, info fs.FileInfo) error {
+	return nil
+}
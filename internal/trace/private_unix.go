@@ -0,0 +1,22 @@
+//go:build unix
+
+package trace
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// checkPrivate makes sure that the file at path, described by info, belongs
+// to the current user and is not open to others when a directory.
+func checkPrivate(path string, info fs.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("insecure %s: not owned by the current user", path)
+	}
+	if info.IsDir() && info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("insecure %s: its mode must be 0700", path)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package trace
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const DefaultProcessTreeInterval = 100 * time.Millisecond
+
+// ProcessTreeConfig enables a child span for every descendant of a wrapped
+// command, seen by polling the process table every Interval. Processes living
+// shorter than Interval may be missed, and exit times are approximate.
+type ProcessTreeConfig struct {
+	Enabled  bool
+	Interval time.Duration
+}
+
+// procStat describes a running process.
+type procStat struct {
+	ppid       int
+	comm       string
+	startTicks uint64
+}
+
+type trackedProcess struct {
+	pid    int
+	stat   procStat
+	args   []string
+	spanID []byte
+	parent *trackedProcess
+	end    time.Time
+}
+
+// processTree follows the descendants of a process until stopped.
+type processTree struct {
+	root     int
+	interval time.Duration
+	boot     time.Time
+	alive    map[int]*trackedProcess
+	exited   []*trackedProcess
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startProcessTree starts polling the descendants of root.
+func startProcessTree(root int, cfg *ProcessTreeConfig) (*processTree, error) {
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+	t := &processTree{
+		root:     root,
+		interval: cfg.Interval,
+		boot:     boot,
+		alive:    map[int]*trackedProcess{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if t.interval <= 0 {
+		t.interval = DefaultProcessTreeInterval
+	}
+	go t.run()
+	return t, nil
+}
+
+func (t *processTree) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		t.poll()
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll records the processes which appeared or exited since the last call.
+func (t *processTree) poll() {
+	procs, err := listProcesses()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for pid, p := range t.alive {
+		// A different start time means the pid was reused.
+		if stat, ok := procs[pid]; !ok || stat.startTicks != p.stat.startTicks {
+			p.end = now
+			t.exited = append(t.exited, p)
+			delete(t.alive, pid)
+		}
+	}
+	// Children may be listed before their parents: iterate until no new
+	// descendant shows up.
+	for found := true; found; {
+		found = false
+		for pid, stat := range procs {
+			if _, ok := t.alive[pid]; ok || pid == t.root {
+				continue
+			}
+			parent, ok := t.alive[stat.ppid]
+			if !ok && stat.ppid != t.root {
+				continue
+			}
+			p := &trackedProcess{pid: pid, stat: stat, args: readCmdline(pid), parent: parent, spanID: make([]byte, 8)}
+			rand.Read(p.spanID)
+			t.alive[pid] = p
+			found = true
+		}
+	}
+}
+
+// Stop stops polling, after a last look at the process table. The processes
+// still running are considered ended now.
+func (t *processTree) Stop() {
+	close(t.stop)
+	<-t.done
+	t.poll()
+	now := time.Now()
+	for _, p := range t.alive {
+		p.end = now
+		t.exited = append(t.exited, p)
+	}
+	t.alive = nil
+}
+
+// spans returns a span per process seen, children of parent.
+func (t *processTree) spans(parent *v1.Span) []*v1.Span {
+	spans := make([]*v1.Span, 0, len(t.exited))
+	for _, p := range t.exited {
+		parentID := parent.SpanId
+		ppid := p.stat.ppid
+		if p.parent != nil {
+			parentID = p.parent.spanID
+		}
+		start := ticksToTime(t.boot, p.stat.startTicks)
+		// Clamp the coarse start time within the parent span.
+		if min := time.Unix(0, int64(parent.StartTimeUnixNano)); start.Before(min) {
+			start = min
+		}
+		if p.end.Before(start) {
+			start = p.end
+		}
+		attrs := []*commonv1.KeyValue{
+			intAttribute(AttributePID, int64(p.pid)),
+			intAttribute(AttributeParentPID, int64(ppid)),
+			stringAttribute(AttributeCommand, p.stat.comm),
+		}
+		if len(p.args) > 0 {
+			attrs = append(attrs,
+				stringsAttribute(AttributeCommandArgs, p.args),
+				stringAttribute(AttributeCommandLine, strings.Join(p.args, " ")),
+			)
+		}
+		span := &v1.Span{
+			TraceId:           parent.TraceId,
+			SpanId:            p.spanID,
+			ParentSpanId:      parentID,
+			TraceState:        parent.TraceState,
+			Name:              p.stat.comm,
+			Kind:              v1.Span_SPAN_KIND_INTERNAL,
+			StartTimeUnixNano: uint64(start.UnixNano()),
+			EndTimeUnixNano:   uint64(p.end.UnixNano()),
+			Attributes:        attrs,
+		}
+		SetSpanTraceFlags(span, SpanTraceFlags(parent))
+		spans = append(spans, span)
+	}
+	return spans
+}
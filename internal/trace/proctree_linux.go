@@ -0,0 +1,95 @@
+//go:build linux
+
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the times in /proc/<pid>/stat. It is 100
+// on every mainstream architecture, and cannot be read without cgo.
+const clockTicks = 100
+
+// listProcesses reads the processes running on the system from /proc.
+func listProcesses() (map[int]procStat, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	procs := make(map[int]procStat, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// The process may have exited since the directory was read.
+		if stat, err := readProcStat(pid); err == nil {
+			procs[pid] = stat
+		}
+	}
+	return procs, nil
+}
+
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name is parenthesized and may itself hold parentheses.
+	open, end := bytes.IndexByte(data, '('), bytes.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("invalid stat for process %d", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("invalid stat for process %d", pid)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, err
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+	return procStat{ppid: ppid, comm: validUTF8(string(data[open+1 : end])), startTicks: start}, nil
+}
+
+// readCmdline returns the arguments of a process. Like its name, they are
+// arbitrary bytes, made valid UTF-8 for the span attributes.
+func readCmdline(pid int) []string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return strings.Split(validUTF8(strings.TrimSuffix(string(data), "\x00")), "\x00")
+}
+
+// bootTime derives the boot time from /proc/uptime, which is more precise
+// than the btime of /proc/stat.
+func bootTime() (time.Time, error) {
+	now := time.Now()
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("invalid /proc/uptime")
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-time.Duration(uptime * float64(time.Second))), nil
+}
+
+func ticksToTime(boot time.Time, ticks uint64) time.Time {
+	return boot.Add(time.Duration(ticks) * time.Second / clockTicks)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package trace
+
+import (
+	"fmt"
+	"time"
+)
+
+// The process tree is read from /proc, which only Linux provides.
+
+func listProcesses() (map[int]procStat, error) {
+	return nil, fmt.Errorf("process trees are only supported on Linux")
+}
+
+func readCmdline(pid int) []string {
+	return nil
+}
+
+func bootTime() (time.Time, error) {
+	return time.Time{}, fmt.Errorf("process trees are only supported on Linux")
+}
+
+func ticksToTime(boot time.Time, ticks uint64) time.Time {
+	return boot
+}
@@ -3,15 +3,14 @@ package trace
 import (
 	"context"
 	"fmt"
-	"time"
+	"io"
+	"os"
 
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	"go.opentelemetry.io/otel/trace"
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
 	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
@@ -35,66 +34,162 @@ const (
 	PushModeOtlpHttp PushMode = "otlphttp"
 )
 
-type spanIDGenerator struct {
-	*v1.Span
-}
+// ScopeName is the instrumentation scope attached to every exported span.
+const ScopeName = "github.com/nlachfr/cotl"
 
-func (g *spanIDGenerator) NewIDs(context.Context) (trace.TraceID, trace.SpanID) {
-	return trace.TraceID(g.TraceId), trace.SpanID(g.SpanId)
+// stdoutClient is an otlptrace.Client printing export requests as OTLP/JSON
+// lines, like cotl collector.
+type stdoutClient struct {
+	w io.Writer
 }
-func (g *spanIDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
-	return trace.SpanID(g.SpanId)
+
+func (c *stdoutClient) Start(context.Context) error { return nil }
+func (c *stdoutClient) Stop(context.Context) error  { return nil }
+func (c *stdoutClient) UploadTraces(_ context.Context, rs []*v1.ResourceSpans) error {
+	data, err := MarshalOTLPJSON(&coltracev1.ExportTraceServiceRequest{ResourceSpans: rs})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.w, string(data))
+	return err
 }
 
 type PushConfig struct {
-	Mode PushMode
-	Span *v1.Span
+	Mode      PushMode
+	Spans     []*v1.Span
+	Resource  ResourceConfig
+	Exporter  ExporterConfig
+	IgnoreEnv bool
+	Spool     string
+	Defer     bool
+	Agent     string
 }
 
-func Push(ctx context.Context, cfg *PushConfig) error {
-	var (
-		err      error
-		exporter sdktrace.SpanExporter
-	)
-	switch cfg.Mode {
+func newClient(mode PushMode, exporter *ExporterConfig) (otlptrace.Client, error) {
+	switch mode {
 	case PushModeStdout:
-		if exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint()); err != nil {
-			return err
-		}
+		return &stdoutClient{w: os.Stdout}, nil
 	case PushModeOtlp:
-		if exporter, err = otlptracegrpc.New(ctx); err != nil {
-			return err
+		opts, err := exporter.grpcOptions()
+		if err != nil {
+			return nil, err
 		}
+		return otlptracegrpc.NewClient(opts...), nil
 	case PushModeOtlpHttp:
-		if exporter, err = otlptracehttp.New(ctx); err != nil {
-			return err
+		opts, err := exporter.httpOptions()
+		if err != nil {
+			return nil, err
 		}
+		return otlptracehttp.NewClient(opts...), nil
 	default:
-		return fmt.Errorf("invalid push mode: %s", cfg.Mode)
-	}
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithIDGenerator(&spanIDGenerator{cfg.Span}),
-		sdktrace.WithBatcher(exporter),
-	)
-	otel.SetTracerProvider(tp)
-	if len(cfg.Span.ParentSpanId) > 0 {
-		spanContext := trace.NewSpanContext(trace.SpanContextConfig{
-			TraceID:    trace.TraceID(cfg.Span.TraceId),
-			SpanID:     trace.SpanID(cfg.Span.ParentSpanId),
-			TraceFlags: 01,
-		})
-		ctx = trace.ContextWithRemoteSpanContext(ctx, spanContext)
-	}
-	_, span := tp.Tracer("").Start(ctx,
-		cfg.Span.Name,
-		trace.WithSpanKind(trace.SpanKind(cfg.Span.Kind)),
-		trace.WithTimestamp(time.Unix(0, int64(cfg.Span.StartTimeUnixNano))),
-	)
-	span.SetStatus(codes.Code(cfg.Span.Status.Code), cfg.Span.Status.Message)
-	if cfg.Span.EndTimeUnixNano != 0 {
-		span.End(trace.WithTimestamp(time.Unix(0, int64(cfg.Span.EndTimeUnixNano))))
-	} else {
-		span.End()
-	}
-	return tp.ForceFlush(ctx)
+		return nil, fmt.Errorf("invalid push mode: %s", mode)
+	}
+}
+
+func upload(ctx context.Context, mode PushMode, exporter *ExporterConfig, rs []*v1.ResourceSpans) error {
+	client, err := newClient(mode, exporter)
+	if err != nil {
+		return err
+	}
+	if err = client.Start(ctx); err != nil {
+		return err
+	}
+	err = uploadWith(ctx, client, exporter, rs)
+	if stopErr := client.Stop(ctx); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+func uploadWith(ctx context.Context, client otlptrace.Client, exporter *ExporterConfig, rs []*v1.ResourceSpans) error {
+	for _, batch := range splitResourceSpans(groupResourceSpans(rs), exporter.maxBatchSize()) {
+		if err := client.UploadTraces(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Push exports cfg.Spans as is, wrapped in a single ResourceSpans and split
+// in as many requests as needed to respect the maximum batch size. When a
+// spool is configured, the spans are written to it instead if deferred or if
+// the export fails, waiting for a later Flush. When an agent listens on
+// cfg.Agent, the spans are handed over to it instead, leaving the exporter and
+// spool settings to the agent.
+func Push(ctx context.Context, cfg *PushConfig) error {
+	if len(cfg.Spans) == 0 {
+		return fmt.Errorf("A span is required")
+	}
+	agent, err := dialAgent(cfg.Agent)
+	if err != nil {
+		return err
+	}
+	return push(ctx, cfg, agent)
+}
+
+// push is Push through agent, or through the exporter of cfg when nil.
+func push(ctx context.Context, cfg *PushConfig, agent *agentClient) error {
+	if !cfg.IgnoreEnv {
+		if tp, state, ok := TraceParentFromEnv(); ok {
+			adoptParent(cfg.Spans, tp, state, map[string]bool{})
+		}
+	}
+	resource, err := NewResource(&cfg.Resource)
+	if err != nil {
+		return err
+	}
+	rs := []*v1.ResourceSpans{{
+		Resource: resource,
+		ScopeSpans: []*v1.ScopeSpans{{
+			Scope: &commonv1.InstrumentationScope{Name: ScopeName},
+			Spans: cfg.Spans,
+		}},
+	}}
+	// The agent batches the spans and exports them to its own backend.
+	if agent != nil {
+		return agent.push(rs)
+	}
+	if cfg.Spool == "" {
+		return upload(ctx, cfg.Mode, &cfg.Exporter, rs)
+	}
+	if !cfg.Defer {
+		// Fail fast: retrying is the job of Flush.
+		exporter := cfg.Exporter
+		exporter.DisableRetry = true
+		if err = upload(ctx, cfg.Mode, &exporter, rs); err == nil {
+			return nil
+		}
+	}
+	if spoolErr := (&Spool{Dir: cfg.Spool}).Write(rs); spoolErr != nil {
+		return spoolErr
+	} else if err != nil {
+		warnSpooled(cfg.Spool, err)
+	}
+	return nil
+}
+
+// warnSpooled tells that spans failing to export with err were written to the
+// spool in dir instead.
+func warnSpooled(dir string, err error) {
+	fmt.Fprintf(os.Stderr, "Warning: export failed, spooled to %s: %s\n", dir, err)
+}
+
+// adoptParent attaches the root spans to tp, moving the spans of their traces
+// to the trace of tp. The moved traces are recorded in traces.
+func adoptParent(spans []*v1.Span, tp *TraceParent, state string, traces map[string]bool) {
+	for _, span := range spans {
+		if len(span.ParentSpanId) == 0 {
+			traces[string(span.TraceId)] = true
+			span.ParentSpanId = tp.ParentID[:]
+			if span.TraceState == "" {
+				span.TraceState = state
+			}
+		}
+	}
+	for _, span := range spans {
+		if traces[string(span.TraceId)] {
+			span.TraceId = tp.TraceID[:]
+			SetSpanTraceFlags(span, tp.TraceFlags)
+		}
+	}
 }
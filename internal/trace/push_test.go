@@ -0,0 +1,132 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	coltracev1 "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+type receiver struct {
+	coltracev1.UnimplementedTraceServiceServer
+	requests chan *coltracev1.ExportTraceServiceRequest
+}
+
+func (r *receiver) Export(_ context.Context, req *coltracev1.ExportTraceServiceRequest) (*coltracev1.ExportTraceServiceResponse, error) {
+	r.requests <- req
+	return &coltracev1.ExportTraceServiceResponse{}, nil
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg := &coltracev1.ExportTraceServiceRequest{}
+	if err = proto.Unmarshal(data, msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.requests <- msg
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func testSpan() *v1.Span {
+	str := func(s string) *commonv1.AnyValue {
+		return &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: s}}
+	}
+	return &v1.Span{
+		TraceId:           bytes.Repeat([]byte{0xab}, 16),
+		SpanId:            bytes.Repeat([]byte{0xcd}, 8),
+		ParentSpanId:      bytes.Repeat([]byte{0xef}, 8),
+		TraceState:        "vendor=value",
+		Name:              "roundtrip",
+		Kind:              v1.Span_SPAN_KIND_CLIENT,
+		StartTimeUnixNano: 1000,
+		EndTimeUnixNano:   2000,
+		Attributes: []*commonv1.KeyValue{
+			{Key: "string", Value: str("value")},
+			{Key: "int", Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_IntValue{IntValue: 42}}},
+		},
+		DroppedAttributesCount: 1,
+		Events: []*v1.Span_Event{{
+			TimeUnixNano: 1500,
+			Name:         "event",
+			Attributes:   []*commonv1.KeyValue{{Key: "key", Value: str("value")}},
+		}},
+		DroppedEventsCount: 2,
+		Links: []*v1.Span_Link{{
+			TraceId:    bytes.Repeat([]byte{0x01}, 16),
+			SpanId:     bytes.Repeat([]byte{0x02}, 8),
+			TraceState: "other=value",
+			Attributes: []*commonv1.KeyValue{{Key: "link", Value: str("value")}},
+		}},
+		DroppedLinksCount: 3,
+		Status: &v1.Status{
+			Message: "failure",
+			Code:    v1.Status_STATUS_CODE_ERROR,
+		},
+	}
+}
+
+func assertRoundTrip(t *testing.T, span *v1.Span, req *coltracev1.ExportTraceServiceRequest) {
+	t.Helper()
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("unexpected request layout: %v", req)
+	}
+	opts := proto.MarshalOptions{Deterministic: true}
+	want, err := opts.Marshal(span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := opts.Marshal(req.ResourceSpans[0].ScopeSpans[0].Spans[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Fatalf("span mismatch:\nwant %x\ngot  %x", want, got)
+	}
+}
+
+func TestPushOtlpRoundTrip(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &receiver{requests: make(chan *coltracev1.ExportTraceServiceRequest, 1)}
+	srv := grpc.NewServer()
+	coltracev1.RegisterTraceServiceServer(srv, r)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://"+lis.Addr().String())
+	span := testSpan()
+	if err := Push(context.Background(), &PushConfig{Mode: PushModeOtlp, Spans: []*v1.Span{span}}); err != nil {
+		t.Fatal(err)
+	}
+	assertRoundTrip(t, span, <-r.requests)
+}
+
+func TestPushOtlpHttpRoundTrip(t *testing.T) {
+	r := &receiver{requests: make(chan *coltracev1.ExportTraceServiceRequest, 1)}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	span := testSpan()
+	if err := Push(context.Background(), &PushConfig{Mode: PushModeOtlpHttp, Spans: []*v1.Span{span}}); err != nil {
+		t.Fatal(err)
+	}
+	assertRoundTrip(t, span, <-r.requests)
+}
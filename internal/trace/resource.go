@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	EnvServiceName        = "OTEL_SERVICE_NAME"
+	EnvResourceAttributes = "OTEL_RESOURCE_ATTRIBUTES"
+	AttributeServiceName  = "service.name"
+)
+
+type ResourceConfig struct {
+	ServiceName string
+	Attributes  SpanAttributes
+}
+
+// NewResource builds the resource describing the entity producing the spans.
+// Flags take precedence over OTEL_SERVICE_NAME, which itself takes precedence
+// over OTEL_RESOURCE_ATTRIBUTES.
+func NewResource(cfg *ResourceConfig) (*resourcev1.Resource, error) {
+	var attrs []*commonv1.KeyValue
+	if env := strings.TrimSpace(os.Getenv(EnvResourceAttributes)); env != "" {
+		for _, part := range strings.Split(env, ",") {
+			key, value, ok := strings.Cut(part, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return nil, fmt.Errorf("invalid %s entry: %q", EnvResourceAttributes, part)
+			}
+			value, err := url.PathUnescape(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s entry: %q", EnvResourceAttributes, part)
+			}
+			attrs = append(attrs, stringAttribute(strings.TrimSpace(key), value))
+		}
+	}
+	if name := strings.TrimSpace(os.Getenv(EnvServiceName)); name != "" {
+		attrs = append(attrs, stringAttribute(AttributeServiceName, name))
+	}
+	attrs = append(attrs, cfg.Attributes.KeyValues()...)
+	if cfg.ServiceName != "" {
+		attrs = append(attrs, stringAttribute(AttributeServiceName, cfg.ServiceName))
+	}
+
+	resource := &resourcev1.Resource{}
+	index := map[string]int{}
+	for _, attr := range attrs {
+		if i, ok := index[attr.Key]; ok {
+			resource.Attributes[i] = attr
+		} else {
+			index[attr.Key] = len(resource.Attributes)
+			resource.Attributes = append(resource.Attributes, attr)
+		}
+	}
+	if _, ok := index[AttributeServiceName]; !ok {
+		resource.Attributes = append(resource.Attributes, stringAttribute(AttributeServiceName, "unknown_service:"+filepath.Base(os.Args[0])))
+	}
+	return resource, nil
+}
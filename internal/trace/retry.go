@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	AttributeRetryAttempt = "retry.attempt"
+	AttributeRetryCount   = "retry.count"
+
+	DefaultRetryAttempts      = 3
+	DefaultRetryBackoff       = time.Second
+	DefaultRetryBackoffFactor = 2
+)
+
+// RetryConfig runs Exec.Args until it succeeds, at most Attempts times. The
+// delay between attempts starts at Backoff and is multiplied by BackoffFactor
+// after each attempt, up to MaxBackoff when set.
+type RetryConfig struct {
+	Exec          ExecConfig
+	Attempts      int
+	Backoff       time.Duration
+	BackoffFactor float64
+	MaxBackoff    time.Duration
+}
+
+// Retry runs cfg.Exec.Args within a new span, with a child span per attempt,
+// and pushes them once done. Commands which cannot be started or were
+// cancelled are not retried. The returned code is the one of the last
+// attempt.
+func Retry(ctx context.Context, cfg *RetryConfig) (int, error) {
+	if cfg.Attempts < 1 {
+		return 1, fmt.Errorf("invalid attempts: %d", cfg.Attempts)
+	} else if cfg.BackoffFactor < 1 {
+		return 1, fmt.Errorf("invalid backoff factor: %g", cfg.BackoffFactor)
+	} else if cfg.MaxBackoff < 0 {
+		return 1, fmt.Errorf("invalid max backoff: %s", cfg.MaxBackoff)
+	}
+	span, signals, err := startExecution(ctx, &cfg.Exec)
+	if err != nil {
+		return 1, err
+	}
+	// Signals stay caught until the spans were pushed.
+	defer signal.Stop(signals)
+
+	var (
+		spans     = []*v1.Span{span}
+		records   []*logsv1.LogRecord
+		run       *commandRun
+		attempts  int
+		cancelled os.Signal
+		backoff   = cfg.Backoff
+	)
+	for attempts < cfg.Attempts {
+		if attempts > 0 {
+			if cancelled = sleep(backoff, signals); cancelled != nil {
+				break
+			}
+			backoff = time.Duration(float64(backoff) * cfg.BackoffFactor)
+			if cfg.MaxBackoff > 0 && backoff > cfg.MaxBackoff {
+				backoff = cfg.MaxBackoff
+			}
+		}
+		attempts++
+		attempt, err := NewSpan(ctx, &SpanConfig{
+			TraceParent: *NewTraceParent(span),
+			TraceState:  span.TraceState,
+			Name:        fmt.Sprintf("attempt %d", attempts),
+			Kind:        cfg.Exec.Span.Kind,
+			IgnoreEnv:   true,
+		})
+		if err != nil {
+			return 1, err
+		}
+		attempt.Attributes = append(attempt.Attributes, intAttribute(AttributeRetryAttempt, int64(attempts)))
+		run = runCommand(ctx, attempt, &cfg.Exec, signals)
+		attempt.Status = run.status
+		spans = append(spans, attempt)
+		spans = append(spans, run.spans...)
+		records = append(records, run.records...)
+		if run.code == 0 || run.err != nil || run.outcome.signal != nil {
+			cancelled = run.outcome.signal
+			break
+		}
+	}
+
+	span.EndTimeUnixNano = uint64(time.Now().UnixNano())
+	span.Attributes = append(span.Attributes,
+		intAttribute(AttributeRetryCount, int64(attempts-1)),
+		intAttribute(AttributeExitCode, int64(run.code)),
+	)
+	if cancelled != nil {
+		span.Attributes = append(span.Attributes, boolAttribute(AttributeCancelled, true))
+	}
+	if cfg.Exec.Span.Status.Code == StatusCodeUnset {
+		span.Status = run.status
+		if cancelled != nil {
+			span.Status = &v1.Status{Code: v1.Status_STATUS_CODE_ERROR, Message: fmt.Sprintf("cancelled: %s", cancelled)}
+		} else if run.status.Code == v1.Status_STATUS_CODE_ERROR {
+			span.Status = &v1.Status{Code: v1.Status_STATUS_CODE_ERROR, Message: fmt.Sprintf("failed after %d attempts: %s", attempts, run.status.Message)}
+		}
+	}
+	err = pushExecution(ctx, &cfg.Exec.Push, spans, records)
+	return run.code, errors.Join(run.err, err)
+}
+
+// sleep waits for d, returning early with the signal received meanwhile, if
+// any.
+func sleep(d time.Duration, signals <-chan os.Signal) os.Signal {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case sig := <-signals:
+		return sig
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package trace
+
+import (
+	"os"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// rusageAttributes is a no-op where wait4 is not available: only the CPU
+// times, known everywhere, are then recorded.
+func rusageAttributes(state *os.ProcessState) []*commonv1.KeyValue {
+	return nil
+}
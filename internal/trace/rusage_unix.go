@@ -0,0 +1,34 @@
+//go:build unix
+
+package trace
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// rusageAttributes describes the resources used by an exited process, as
+// reported by wait4.
+func rusageAttributes(state *os.ProcessState) []*commonv1.KeyValue {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	// ru_maxrss is in kilobytes, except on macOS where it is in bytes.
+	maxRSS := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024
+	}
+	return []*commonv1.KeyValue{
+		intAttribute(AttributeMaxRSS, maxRSS),
+		intAttribute(AttributeMinorFaults, int64(ru.Minflt)),
+		intAttribute(AttributeMajorFaults, int64(ru.Majflt)),
+		intAttribute(AttributeVoluntarySwitches, int64(ru.Nvcsw)),
+		intAttribute(AttributeInvoluntarySwitches, int64(ru.Nivcsw)),
+		intAttribute(AttributeDiskReads, int64(ru.Inblock)),
+		intAttribute(AttributeDiskWrites, int64(ru.Oublock)),
+	}
+}
@@ -5,13 +5,15 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel/trace"
-	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
 	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -32,43 +34,48 @@ func (t *TraceParent) String() string {
 	)
 }
 
+// Set parses a traceparent following the W3C Trace Context specification:
+// lowercase hex fields, non-zero identifiers, and no version ff. Versions
+// above 00 may carry extra fields, which are ignored.
 func (t *TraceParent) Set(s string) error {
 	parts := strings.Split(s, "-")
-	if len(parts) != 4 {
-		return fmt.Errorf("invalid traceparent")
+	if len(parts) < 4 || len(parts[0]) != 2 || !isLowerHex(parts[0]) {
+		return fmt.Errorf("invalid traceparent: %s", s)
 	}
-	if version, err := hex.DecodeString(parts[0]); err != nil {
-		return err
-	} else if len(version) != 1 {
+	version, _ := hex.DecodeString(parts[0])
+	if version[0] == 0xff {
 		return fmt.Errorf("invalid version: %s", parts[0])
-	} else {
-		t.Version = version[0]
 	}
-	if traceId, err := hex.DecodeString(parts[1]); err != nil {
-		return err
-	} else if len(traceId) != 16 {
+	tp := TraceParent{Version: version[0], valid: true}
+	if len(parts) > 4 && (tp.Version == 0x00 || parts[4] == "") {
+		return fmt.Errorf("invalid traceparent: %s", s)
+	}
+	if len(parts[1]) != 32 || !isLowerHex(parts[1]) || strings.Trim(parts[1], "0") == "" {
 		return fmt.Errorf("invalid traceid: %s", parts[1])
-	} else {
-		t.TraceID = [16]byte(traceId)
 	}
-	if parentId, err := hex.DecodeString(parts[2]); err != nil {
-		return err
-	} else if len(parentId) != 8 {
+	hex.Decode(tp.TraceID[:], []byte(parts[1]))
+	if len(parts[2]) != 16 || !isLowerHex(parts[2]) || strings.Trim(parts[2], "0") == "" {
 		return fmt.Errorf("invalid parentid: %s", parts[2])
-	} else {
-		t.ParentID = [8]byte(parentId)
 	}
-	if flags, err := hex.DecodeString(parts[3]); err != nil {
-		return err
-	} else if len(flags) != 1 {
+	hex.Decode(tp.ParentID[:], []byte(parts[2]))
+	if len(parts[3]) != 2 || !isLowerHex(parts[3]) {
 		return fmt.Errorf("invalid traceflags: %s", parts[3])
-	} else {
-		t.TraceFlags = flags[0]
 	}
-	t.valid = true
+	flags, _ := hex.DecodeString(parts[3])
+	tp.TraceFlags = flags[0]
+	*t = tp
 	return nil
 }
 
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func (v *TraceParent) Type() string {
 	return "TraceParent"
 }
@@ -77,6 +84,106 @@ func (t *TraceParent) IsValid() bool {
 	return t.valid
 }
 
+// Sampled reports whether the sampled trace flag is set.
+func (t *TraceParent) Sampled() bool {
+	return t.TraceFlags&TraceFlagsSampled != 0
+}
+
+const TraceFlagsSampled byte = 0x01
+
+const (
+	EnvTraceParent = "TRACEPARENT"
+	EnvTraceState  = "TRACESTATE"
+)
+
+// TraceParentFromEnv reads the parent propagated through the TRACEPARENT and
+// TRACESTATE environment variables. Invalid values are ignored, as mandated
+// by the W3C specification.
+func TraceParentFromEnv() (*TraceParent, string, bool) {
+	value, ok := os.LookupEnv(EnvTraceParent)
+	if !ok {
+		return nil, "", false
+	}
+	tp := &TraceParent{}
+	if err := tp.Set(strings.TrimSpace(value)); err != nil {
+		return nil, "", false
+	}
+	return tp, strings.TrimSpace(os.Getenv(EnvTraceState)), true
+}
+
+// NewTraceParent returns the traceparent to propagate to the children of span,
+// carrying its trace flags.
+func NewTraceParent(span *v1.Span) *TraceParent {
+	return &TraceParent{
+		Version:    0x00,
+		TraceID:    [16]byte(span.TraceId),
+		ParentID:   [8]byte(span.SpanId),
+		TraceFlags: SpanTraceFlags(span),
+		valid:      true,
+	}
+}
+
+// spanFlagsField is the number of the flags field of spans, whose low byte
+// holds the trace flags of their context. The vendored OTLP protocol predates
+// it, so it is kept among the unknown fields, which are still encoded in the
+// wire format but dropped by the JSON mappings.
+const spanFlagsField protowire.Number = 16
+
+// SpanTraceFlags returns the trace flags of span, sampled when unknown.
+func SpanTraceFlags(span *v1.Span) byte {
+	if flags, ok := LookupSpanTraceFlags(span); ok {
+		return flags
+	}
+	return TraceFlagsSampled
+}
+
+// LookupSpanTraceFlags returns the trace flags of span, if it has some.
+func LookupSpanTraceFlags(span *v1.Span) (flags byte, ok bool) {
+	unknown := span.ProtoReflect().GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			break
+		}
+		unknown = unknown[n:]
+		if num == spanFlagsField && typ == protowire.Fixed32Type {
+			v, m := protowire.ConsumeFixed32(unknown)
+			if m < 0 {
+				break
+			}
+			flags, ok = byte(v), true
+		}
+		if n = protowire.ConsumeFieldValue(num, typ, unknown); n < 0 {
+			break
+		}
+		unknown = unknown[n:]
+	}
+	return flags, ok
+}
+
+// SetSpanTraceFlags replaces the trace flags of span.
+func SetSpanTraceFlags(span *v1.Span, flags byte) {
+	var kept []byte
+	unknown := span.ProtoReflect().GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			break
+		}
+		m := protowire.ConsumeFieldValue(num, typ, unknown[n:])
+		if m < 0 {
+			break
+		}
+		if num != spanFlagsField {
+			kept = append(kept, unknown[:n+m]...)
+		}
+		unknown = unknown[n+m:]
+	}
+	kept = protowire.AppendTag(kept, spanFlagsField, protowire.Fixed32Type)
+	kept = protowire.AppendFixed32(kept, uint32(flags))
+	span.ProtoReflect().SetUnknown(kept)
+}
+
 type SpanTime struct {
 	unixTime uint64
 }
@@ -85,42 +192,79 @@ func (v *SpanTime) String() string {
 	return time.Unix(0, int64(v.unixTime)).String()
 }
 
+// Set accepts RFC3339 timestamps, Unix epoch values in seconds, milliseconds,
+// microseconds or nanoseconds (told apart by their magnitude, with an optional
+// fractional part), "now" and times relative to now such as "-90s" or
+// "now+1m".
 func (v *SpanTime) Set(s string) error {
-	t, err := time.Parse(time.RFC3339, s)
-	if err != nil {
-		return err
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		v.unixTime = uint64(t.UnixNano())
+		return nil
+	} else if unixTime, ok := parseEpoch(s); ok {
+		v.unixTime = unixTime
+		return nil
 	}
-	v.unixTime = uint64(t.UnixNano())
+	now := time.Now()
+	rel, ok := strings.CutPrefix(s, "now")
+	if !ok && !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+") {
+		return fmt.Errorf("invalid time: %s", s)
+	}
+	if rel != "" {
+		d, err := time.ParseDuration(rel)
+		if err != nil || (rel[0] != '-' && rel[0] != '+') {
+			return fmt.Errorf("invalid time: %s", s)
+		}
+		now = now.Add(d)
+	}
+	v.unixTime = uint64(now.UnixNano())
 	return nil
 }
 
-func (v *SpanTime) Type() string {
-	return "SpanTime"
-}
-
-type SpanAttributes struct {
-	attrs []*commonv1.KeyValue
-}
-
-func (a *SpanAttributes) String() string { return fmt.Sprintf("%v", a.attrs) }
-func (a *SpanAttributes) Set(s string) error {
-	for _, part := range strings.Split(s, ",") {
-		kv := strings.Split(part, "=")
-		if len(kv) != 2 {
-			return fmt.Errorf("typo error")
+// parseEpoch parses a decimal Unix epoch value, guessing its unit from the
+// magnitude of its integer part.
+func parseEpoch(s string) (uint64, bool) {
+	integer, fraction, _ := strings.Cut(s, ".")
+	i, err := strconv.ParseUint(integer, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	for _, r := range fraction {
+		if r < '0' || r > '9' {
+			return 0, false
 		}
-		a.attrs = append(a.attrs, &commonv1.KeyValue{
-			Key:   kv[0],
-			Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: kv[1]}},
-		})
 	}
-	return nil
+	var digits int
+	switch {
+	case i < 1e11:
+		digits = 9
+	case i < 1e14:
+		digits = 6
+	case i < 1e17:
+		digits = 3
+	default:
+		return i, fraction == "" && i <= math.MaxInt64
+	}
+	fraction = (fraction + strings.Repeat("0", digits))[:digits]
+	f, _ := strconv.ParseUint(fraction, 10, 64)
+	unit := uint64(1)
+	for ; digits > 0; digits-- {
+		unit *= 10
+	}
+	// Times are nanoseconds held in an int64.
+	if i > (math.MaxInt64-f)/unit {
+		return 0, false
+	}
+	return i*unit + f, true
+}
+
+func (v *SpanTime) Type() string {
+	return "SpanTime"
 }
-func (a *SpanAttributes) Type() string { return "SpanAttributes" }
 
 type StatusCode uint64
 
-func (m *StatusCode) String() string { return string(*m) }
+func (m *StatusCode) String() string { return strconv.FormatUint(uint64(*m), 10) }
 func (m *StatusCode) Set(s string) error {
 	i, err := strconv.ParseUint(s, 10, 8)
 	if err != nil {
@@ -142,31 +286,93 @@ const (
 	StatusCodeError StatusCode = 2
 )
 
+type SpanKind string
+
+func (k *SpanKind) String() string { return string(*k) }
+func (k *SpanKind) Set(s string) error {
+	switch s {
+	case string(SpanKindInternal), string(SpanKindServer), string(SpanKindClient), string(SpanKindProducer), string(SpanKindConsumer):
+		*k = SpanKind(s)
+	default:
+		return fmt.Errorf("invalid span kind: %s", s)
+	}
+	return nil
+}
+func (k *SpanKind) Type() string { return "spanKind" }
+
+const (
+	SpanKindInternal SpanKind = "internal"
+	SpanKindServer   SpanKind = "server"
+	SpanKindClient   SpanKind = "client"
+	SpanKindProducer SpanKind = "producer"
+	SpanKindConsumer SpanKind = "consumer"
+)
+
+var spanKinds = map[SpanKind]v1.Span_SpanKind{
+	SpanKindInternal: v1.Span_SPAN_KIND_INTERNAL,
+	SpanKindServer:   v1.Span_SPAN_KIND_SERVER,
+	SpanKindClient:   v1.Span_SPAN_KIND_CLIENT,
+	SpanKindProducer: v1.Span_SPAN_KIND_PRODUCER,
+	SpanKindConsumer: v1.Span_SPAN_KIND_CONSUMER,
+}
+
 type SpanConfig struct {
 	TraceID     []byte
 	SpanID      []byte
 	TraceState  string
 	TraceParent TraceParent
 	Name        string
+	Kind        SpanKind
 	StartTime   SpanTime
 	EndTime     SpanTime
+	Duration    time.Duration
 	Attributes  SpanAttributes
+	Links       SpanLinks
 	Status      struct {
 		Code        StatusCode
 		Description string
 	}
-	BaseSpan *v1.Span
+	BaseSpan  *v1.Span
+	IgnoreEnv bool
+	State     StateConfig
 }
 
 func NewSpan(ctx context.Context, cfg *SpanConfig) (*v1.Span, error) {
 	if cfg.BaseSpan == nil {
 		cfg.BaseSpan = &v1.Span{}
 	}
+	if cfg.Duration != 0 && cfg.EndTime.unixTime != 0 {
+		return nil, fmt.Errorf("end time and duration are mutually exclusive")
+	}
 	span := &v1.Span{}
+	// Explicit parents come first, then the open named span of the session,
+	// which is more specific than TRACEPARENT, inherited from the whole job.
+	if len(cfg.TraceID) == 0 && len(cfg.BaseSpan.TraceId) == 0 && !cfg.TraceParent.IsValid() {
+		// The state store is only an implicit parent here: unlike for start
+		// and end, failing to read it must not fail the span.
+		if current, err := cfg.State.Current(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring the open named spans: %s\n", err)
+		} else if current != nil {
+			cfg.TraceParent = *NewTraceParent(current)
+			if cfg.TraceState == "" {
+				cfg.TraceState = current.TraceState
+			}
+		}
+	}
+	if !cfg.IgnoreEnv && len(cfg.TraceID) == 0 && len(cfg.BaseSpan.TraceId) == 0 && !cfg.TraceParent.IsValid() {
+		if tp, state, ok := TraceParentFromEnv(); ok {
+			cfg.TraceParent = *tp
+			if cfg.TraceState == "" {
+				cfg.TraceState = state
+			}
+		}
+	}
+	flags := TraceFlagsSampled
 	if len(cfg.TraceID) == 0 {
 		if cfg.TraceParent.IsValid() {
 			span.TraceId = cfg.TraceParent.TraceID[:]
 			span.ParentSpanId = cfg.TraceParent.ParentID[:]
+			flags = cfg.TraceParent.TraceFlags
 		} else {
 			id := trace.TraceID{}
 			if _, err := rand.Read(id[:]); err != nil {
@@ -194,15 +400,26 @@ func NewSpan(ctx context.Context, cfg *SpanConfig) (*v1.Span, error) {
 	}
 	proto.Merge(span, cfg.BaseSpan)
 	proto.Merge(span, &v1.Span{
+		TraceId:           cfg.TraceID,
+		SpanId:            cfg.SpanID,
 		TraceState:        cfg.TraceState,
 		Name:              cfg.Name,
+		Kind:              spanKinds[cfg.Kind],
 		StartTimeUnixNano: cfg.StartTime.unixTime,
 		EndTimeUnixNano:   cfg.EndTime.unixTime,
 		Attributes:        cfg.Attributes.attrs,
+		Links:             cfg.Links.links,
 		Status: &v1.Status{
 			Message: cfg.Status.Description,
 			Code:    code,
 		},
 	})
+	if cfg.Duration != 0 {
+		span.EndTimeUnixNano = uint64(int64(span.StartTimeUnixNano) + int64(cfg.Duration))
+	}
+	if f, ok := LookupSpanTraceFlags(cfg.BaseSpan); ok {
+		flags = f
+	}
+	SetSpanTraceFlags(span, flags)
 	return span, nil
 }
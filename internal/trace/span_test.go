@@ -0,0 +1,163 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEpoch(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  uint64
+		ok    bool
+	}{
+		// Seconds, as printed by date +%s and $EPOCHREALTIME.
+		{input: "1700000000", want: 1700000000_000000000, ok: true},
+		{input: "1700000000.", want: 1700000000_000000000, ok: true},
+		{input: "1700000000.123456", want: 1700000000_123456000, ok: true},
+		{input: "1700000000.000001", want: 1700000000_000001000, ok: true},
+		{input: "1700000000.123456789123", want: 1700000000_123456789, ok: true},
+		// Milliseconds, microseconds and nanoseconds.
+		{input: "1700000000123", want: 1700000000_123000000, ok: true},
+		{input: "1700000000123.5", want: 1700000000_123500000, ok: true},
+		{input: "1700000000123456", want: 1700000000_123456000, ok: true},
+		{input: "1700000000123456789", want: 1700000000_123456789, ok: true},
+		{input: "1700000000123456789.5"},
+		// Values past the year 2262 overflow int64 nanoseconds.
+		{input: "9223372036", want: 9223372036_000000000, ok: true},
+		{input: "9223372037"},
+		{input: "9999999999"},
+		{input: "99999999999999"},
+		{input: "99999999999999999"},
+		{input: "9223372036854775807", want: 9223372036854775807, ok: true},
+		{input: "9223372036854775808"},
+		{input: "18446744073709551616"},
+		{input: ""},
+		{input: ".5"},
+		{input: "-1700000000"},
+		{input: "1700000000,123456"},
+		{input: "1700000000.12a"},
+		{input: "2023-11-14T22:13:20Z"},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := parseEpoch(tt.input)
+			if ok != tt.ok || ok && got != tt.want {
+				t.Fatalf("want %d, %t, got %d, %t", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestTraceParentSet(t *testing.T) {
+	const (
+		traceID  = "0af7651916cd43dd8448eb211c80319c"
+		parentID = "b7ad6b7169203331"
+	)
+	for _, tt := range []struct {
+		input   string
+		version byte
+		flags   byte
+		err     bool
+	}{
+		{input: "00-" + traceID + "-" + parentID + "-01", flags: 0x01},
+		{input: "00-" + traceID + "-" + parentID + "-00"},
+		{input: "00-" + traceID + "-" + parentID + "-09", flags: 0x09},
+		// Future versions may append fields, which are ignored.
+		{input: "01-" + traceID + "-" + parentID + "-01", version: 0x01, flags: 0x01},
+		{input: "cc-" + traceID + "-" + parentID + "-01-extra", version: 0xcc, flags: 0x01},
+		{input: "cc-" + traceID + "-" + parentID + "-01-", err: true},
+		{input: "00-" + traceID + "-" + parentID + "-01-extra", err: true},
+		{input: "ff-" + traceID + "-" + parentID + "-01", err: true},
+		{input: "00-00000000000000000000000000000000-" + parentID + "-01", err: true},
+		{input: "00-" + traceID + "-0000000000000000-01", err: true},
+		{input: "00-" + strings.ToUpper(traceID) + "-" + parentID + "-01", err: true},
+		{input: "00-" + traceID[1:] + "-" + parentID + "-01", err: true},
+		{input: "00-" + traceID + "-" + parentID + "0-01", err: true},
+		{input: "00-" + traceID + "-" + parentID + "-1", err: true},
+		{input: "00-" + traceID + "-" + parentID + "-0g", err: true},
+		{input: "0-" + traceID + "-" + parentID + "-01", err: true},
+		{input: "00-" + traceID + "-" + parentID, err: true},
+		{input: "", err: true},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			tp := &TraceParent{}
+			err := tp.Set(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", tp)
+				} else if tp.IsValid() {
+					t.Fatalf("invalid traceparent kept: %s", tp)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if tp.Version != tt.version || tp.TraceFlags != tt.flags || hex.EncodeToString(tp.TraceID[:]) != traceID || hex.EncodeToString(tp.ParentID[:]) != parentID {
+				t.Fatalf("unexpected fields: %+v", tp)
+			}
+		})
+	}
+}
+
+func TestNewSpanIDs(t *testing.T) {
+	traceID, _ := hex.DecodeString("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := hex.DecodeString("b7ad6b7169203331")
+	span, err := NewSpan(context.Background(), &SpanConfig{
+		TraceID:   traceID,
+		SpanID:    spanID,
+		Name:      "test",
+		IgnoreEnv: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(span.TraceId, traceID) || !bytes.Equal(span.SpanId, spanID) {
+		t.Fatalf("want %x/%x, got %x/%x", traceID, spanID, span.TraceId, span.SpanId)
+	}
+}
+
+func TestNewSpanParent(t *testing.T) {
+	const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	t.Setenv(EnvTraceParent, traceParent)
+	state := StateConfig{Dir: filepath.Join(t.TempDir(), "state"), Session: "test"}
+	span, err := NewSpan(context.Background(), &SpanConfig{State: state})
+	if err != nil {
+		t.Fatal(err)
+	} else if got := hex.EncodeToString(span.ParentSpanId); got != traceParent[36:52] {
+		t.Fatalf("want the TRACEPARENT parent %s, got %s", traceParent[36:52], got)
+	}
+	// Once a named span is open, it nests below TRACEPARENT and parents the
+	// spans created in between.
+	step, err := Start(context.Background(), "step1", &SpanConfig{State: state})
+	if err != nil {
+		t.Fatal(err)
+	} else if got := hex.EncodeToString(step.ParentSpanId); got != traceParent[36:52] {
+		t.Fatalf("want the TRACEPARENT parent %s, got %s", traceParent[36:52], got)
+	}
+	span, err = NewSpan(context.Background(), &SpanConfig{State: state})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(span.ParentSpanId, step.SpanId) || !bytes.Equal(span.TraceId, step.TraceId) {
+		t.Fatalf("want the parent %x, got %x", step.SpanId, span.ParentSpanId)
+	}
+}
+
+func TestNewSpanDefaultSession(t *testing.T) {
+	t.Setenv(EnvTraceParent, "")
+	state := StateConfig{Dir: filepath.Join(t.TempDir(), "state")}
+	if _, err := Start(context.Background(), "step1", &SpanConfig{State: state}); err != nil {
+		t.Fatal(err)
+	}
+	// The default session is shared by every shell of the user, so that its
+	// open spans are not implicit parents.
+	span, err := NewSpan(context.Background(), &SpanConfig{State: state})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(span.ParentSpanId) != 0 {
+		t.Fatalf("want a root span, got the parent %x", span.ParentSpanId)
+	}
+}
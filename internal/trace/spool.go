@@ -0,0 +1,215 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	spoolLock             = ".lock"
+	spoolFlushLock        = ".flush.lock"
+	spoolExtension        = ".pb"
+	spoolInvalidExtension = ".invalid"
+)
+
+// Spool is a directory holding spans waiting to be exported. Every entry is a
+// TracesData protobuf, written atomically so that concurrent readers never
+// see partial files.
+type Spool struct {
+	Dir string
+}
+
+// lock acquires the spool lock: writers share it while Flush holds it
+// exclusively when listing the entries.
+func (s *Spool) lock(exclusive bool) (*os.File, error) {
+	return s.lockFile(spoolLock, exclusive)
+}
+
+func (s *Spool) lockFile(name string, exclusive bool) (*os.File, error) {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(s.Dir, name), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write stores rs as a new spool entry.
+func (s *Spool) Write(rs []*v1.ResourceSpans) error {
+	lock, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	data, err := proto.Marshal(&v1.TracesData{ResourceSpans: rs})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), strings.TrimPrefix(filepath.Base(tmp.Name()), ".tmp-"), spoolExtension)
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+}
+
+type FlushConfig struct {
+	Mode     PushMode
+	Exporter ExporterConfig
+	Spool    string
+	Attempts int
+	Backoff  time.Duration
+	MaxAge   time.Duration
+}
+
+const maxFlushBackoff = time.Minute
+
+// Flush exports every entry of the spool in a single request, retrying with
+// an exponential backoff. Entries older than cfg.MaxAge are discarded, and
+// spans spooled more than once are only exported in their latest version.
+// Unreadable entries are moved aside with the .invalid extension and
+// reported once the others were exported.
+//
+// The spool is only locked while listing the entries, so that writers are
+// not blocked during the export: concurrent flushes are serialized by a lock
+// of their own.
+func Flush(ctx context.Context, cfg *FlushConfig) error {
+	if cfg.Spool == "" {
+		return fmt.Errorf("A spool directory is required")
+	}
+	spool := &Spool{Dir: cfg.Spool}
+	flushLock, err := spool.lockFile(spoolFlushLock, true)
+	if err != nil {
+		return err
+	}
+	defer flushLock.Close()
+	paths, rs, invalid, err := spool.snapshot(cfg.MaxAge)
+	if err != nil {
+		return err
+	}
+	if len(rs) > 0 {
+		backoff := cfg.Backoff
+		exporter := cfg.Exporter
+		exporter.DisableRetry = true
+		for attempt := 1; ; attempt++ {
+			if err = upload(ctx, cfg.Mode, &exporter, rs); err == nil {
+				break
+			} else if attempt >= cfg.Attempts {
+				return errors.Join(fmt.Errorf("flush failed after %d attempts: %w", attempt, err), invalid)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxFlushBackoff {
+				backoff = maxFlushBackoff
+			}
+		}
+	}
+	for _, path := range paths {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return invalid
+}
+
+// snapshot reads the entries of the spool under its exclusive lock, removing
+// those older than maxAge and moving aside those which cannot be read.
+func (s *Spool) snapshot(maxAge time.Duration) (paths []string, rs []*v1.ResourceSpans, invalid error, err error) {
+	lock, err := s.lock(true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer lock.Close()
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() > entries[j].Name() })
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != spoolExtension {
+			continue
+		}
+		path := filepath.Join(s.Dir, entry.Name())
+		if info, err := entry.Info(); err != nil {
+			return nil, nil, nil, err
+		} else if maxAge > 0 && time.Since(info.ModTime()) > maxAge {
+			if err = os.Remove(path); err != nil {
+				return nil, nil, nil, err
+			}
+			continue
+		}
+		traces := &v1.TracesData{}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = proto.Unmarshal(data, traces)
+		}
+		if err != nil {
+			invalid = errors.Join(invalid, fmt.Errorf("invalid spool entry %s, moved aside: %w", path, err))
+			if err = os.Rename(path, path+spoolInvalidExtension); err != nil {
+				return nil, nil, nil, err
+			}
+			continue
+		}
+		paths = append(paths, path)
+		rs = append(rs, dedupSpans(traces.ResourceSpans, seen)...)
+	}
+	return paths, rs, invalid, nil
+}
+
+// dedupSpans drops the spans of rs whose ID was already seen, as well as the
+// scopes and resources left empty.
+func dedupSpans(rs []*v1.ResourceSpans, seen map[string]bool) []*v1.ResourceSpans {
+	var result []*v1.ResourceSpans
+	for _, r := range rs {
+		var scopes []*v1.ScopeSpans
+		for _, scope := range r.ScopeSpans {
+			var spans []*v1.Span
+			for _, span := range scope.Spans {
+				id := hex.EncodeToString(span.TraceId) + hex.EncodeToString(span.SpanId)
+				if !seen[id] {
+					seen[id] = true
+					spans = append(spans, span)
+				}
+			}
+			if len(spans) > 0 {
+				scope.Spans = spans
+				scopes = append(scopes, scope)
+			}
+		}
+		if len(scopes) > 0 {
+			r.ScopeSpans = scopes
+			result = append(result, r)
+		}
+	}
+	return result
+}
@@ -0,0 +1,445 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	EnvStateDir      = "COTL_STATE_DIR"
+	EnvSession       = "COTL_SESSION"
+	envRuntimeDir    = "XDG_RUNTIME_DIR"
+	DefaultSession   = "default"
+	DefaultStateTTL  = 24 * time.Hour
+	stateSpanSuffix  = ".span"
+	stateTempPattern = ".tmp-*"
+	stateSeqFile     = ".seq"
+)
+
+var errNoSpan = errors.New("no open span")
+
+// DefaultStateDir returns the directory holding the named spans, from
+// COTL_STATE_DIR or else in the runtime directory of the user, defaulting to
+// their cache directory.
+func DefaultStateDir() string {
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return dir
+	} else if dir := os.Getenv(envRuntimeDir); dir != "" {
+		return filepath.Join(dir, "cotl")
+	} else if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "cotl")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("cotl-%d", os.Getuid()))
+}
+
+// privateDir creates dir when missing, and makes sure that it is private to
+// the current user: others could otherwise plant spans or sockets in it.
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return checkPrivateDir(dir)
+}
+
+func checkPrivateDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("insecure %s: not a directory", dir)
+	}
+	return checkPrivate(dir, info)
+}
+
+// DefaultSessionID returns the session from COTL_SESSION, empty when unset to
+// select the default one.
+func DefaultSessionID() string {
+	return os.Getenv(EnvSession)
+}
+
+// stateStore persists the open named spans, grouped by session.
+type stateStore interface {
+	save(session, name string, span *v1.Span) error
+	load(session, name string) (*v1.Span, error)
+	remove(session, name string) error
+	current(session string) (*v1.Span, error)
+	addEvent(session, name string, event *v1.Span_Event) error
+}
+
+// StateConfig locates the named spans of a session. They are held by the
+// agent listening on Agent when there is one, or else stored in Dir. An empty
+// Dir and no agent disables the state store. Spans stored in Dir expire once
+// left untouched for TTL. An empty Session selects the default session, whose
+// open spans are not implicit parents: it is shared by every shell and job of
+// the user.
+type StateConfig struct {
+	Dir     string
+	Session string
+	Agent   string
+	TTL     time.Duration
+}
+
+func (c *StateConfig) session() string {
+	if c.Session == "" {
+		return DefaultSession
+	}
+	return c.Session
+}
+
+func (c *StateConfig) store() (stateStore, error) {
+	if c.Dir != "" {
+		if err := checkPrivateDir(c.Dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	agent, err := dialAgent(c.Agent)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case agent != nil && c.Dir != "":
+		return &fallbackStore{agent, &fileStore{dir: c.Dir, ttl: c.TTL}}, nil
+	case agent != nil:
+		return agent, nil
+	case c.Dir != "":
+		return &fileStore{dir: c.Dir, ttl: c.TTL}, nil
+	}
+	return nil, nil
+}
+
+// open returns the store holding the open span called name.
+func (c *StateConfig) open(name string) (stateStore, error) {
+	store, err := c.store()
+	if err != nil {
+		return nil, err
+	} else if store == nil {
+		return nil, fmt.Errorf("A state directory is required")
+	} else if name == "" {
+		return nil, fmt.Errorf("A span name is required")
+	}
+	return store, nil
+}
+
+func (c *StateConfig) wrap(name string, err error) error {
+	if errors.Is(err, errNoSpan) {
+		return fmt.Errorf("no open span named %s in session %s", name, c.session())
+	}
+	return err
+}
+
+func (c *StateConfig) load(name string) (*v1.Span, error) {
+	store, err := c.open(name)
+	if err != nil {
+		return nil, err
+	}
+	span, err := store.load(c.session(), name)
+	return span, c.wrap(name, err)
+}
+
+func (c *StateConfig) addEvent(name string, event *v1.Span_Event) error {
+	store, err := c.open(name)
+	if err != nil {
+		return err
+	}
+	return c.wrap(name, store.addEvent(c.session(), name, event))
+}
+
+// Current returns the most recently started open span of the session, or nil
+// when there is none or the session is the default one.
+func (c *StateConfig) Current() (*v1.Span, error) {
+	if c.Session == "" {
+		return nil, nil
+	}
+	store, err := c.store()
+	if store == nil {
+		return nil, err
+	}
+	span, err := store.current(c.session())
+	if errors.Is(err, errNoSpan) {
+		return nil, nil
+	}
+	return span, err
+}
+
+// fallbackStore writes the named spans through to both primary and fallback,
+// so that they outlive the agent, but finds them in primary first. Spans only
+// found in fallback were stored there before, such as the spans started
+// before the agent.
+type fallbackStore struct {
+	primary, fallback stateStore
+}
+
+// each applies update to both stores, failing with errNoSpan only when
+// neither holds the span.
+func (s *fallbackStore) each(update func(stateStore) error) error {
+	primaryErr, fallbackErr := update(s.primary), update(s.fallback)
+	switch {
+	case errors.Is(primaryErr, errNoSpan) && errors.Is(fallbackErr, errNoSpan):
+		return errNoSpan
+	case errors.Is(primaryErr, errNoSpan):
+		return fallbackErr
+	case errors.Is(fallbackErr, errNoSpan):
+		return primaryErr
+	}
+	return errors.Join(primaryErr, fallbackErr)
+}
+
+func (s *fallbackStore) save(session, name string, span *v1.Span) error {
+	return s.each(func(store stateStore) error {
+		return store.save(session, name, span)
+	})
+}
+
+func (s *fallbackStore) load(session, name string) (*v1.Span, error) {
+	span, err := s.primary.load(session, name)
+	if errors.Is(err, errNoSpan) {
+		return s.fallback.load(session, name)
+	}
+	return span, err
+}
+
+func (s *fallbackStore) remove(session, name string) error {
+	return s.each(func(store stateStore) error {
+		return store.remove(session, name)
+	})
+}
+
+func (s *fallbackStore) current(session string) (*v1.Span, error) {
+	span, err := s.primary.current(session)
+	if errors.Is(err, errNoSpan) {
+		return s.fallback.current(session)
+	}
+	return span, err
+}
+
+func (s *fallbackStore) addEvent(session, name string, event *v1.Span_Event) error {
+	return s.each(func(store stateStore) error {
+		return store.addEvent(session, name, event)
+	})
+}
+
+// fileStore stores every named span in its own file, under a directory per
+// session. Each file starts with the sequence number of its span, which
+// orders the open spans: timestamps may be too coarse to. Spans left
+// untouched for ttl are expired.
+type fileStore struct {
+	dir string
+	ttl time.Duration
+}
+
+func (s *fileStore) sessionDir(session string) string {
+	return filepath.Join(s.dir, url.PathEscape(session))
+}
+
+func (s *fileStore) path(session, name string) string {
+	return filepath.Join(s.sessionDir(session), url.PathEscape(name)+stateSpanSuffix)
+}
+
+// nextSeq increments the sequence number of session.
+func (s *fileStore) nextSeq(session string) (uint64, error) {
+	if err := privateDir(s.dir); err != nil {
+		return 0, err
+	} else if err = os.MkdirAll(s.sessionDir(session), 0o700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(filepath.Join(s.sessionDir(session), stateSeqFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err = lockFile(f, true); err != nil {
+		return 0, err
+	}
+	var buf [8]byte
+	if _, err = f.ReadAt(buf[:], 0); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	seq := binary.BigEndian.Uint64(buf[:]) + 1
+	binary.BigEndian.PutUint64(buf[:], seq)
+	_, err = f.WriteAt(buf[:], 0)
+	return seq, err
+}
+
+func (s *fileStore) save(session, name string, span *v1.Span) error {
+	seq, err := s.nextSeq(session)
+	if err != nil {
+		return err
+	}
+	return s.write(session, name, seq, span)
+}
+
+// write atomically stores span as the open span called name.
+func (s *fileStore) write(session, name string, seq uint64, span *v1.Span) error {
+	path := s.path(session, name)
+	data, err := proto.Marshal(span)
+	if err != nil {
+		return err
+	}
+	data = append(binary.BigEndian.AppendUint64(nil, seq), data...)
+	if err = privateDir(s.dir); err != nil {
+		return err
+	} else if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), stateTempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fileStore) read(session, name string) (uint64, *v1.Span, error) {
+	data, err := os.ReadFile(s.path(session, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil, errNoSpan
+	} else if err != nil {
+		return 0, nil, err
+	} else if len(data) < 8 {
+		return 0, nil, fmt.Errorf("invalid state for span %s: truncated file", name)
+	}
+	span := &v1.Span{}
+	if err = proto.Unmarshal(data[8:], span); err != nil {
+		return 0, nil, fmt.Errorf("invalid state for span %s: %w", name, err)
+	}
+	return binary.BigEndian.Uint64(data), span, nil
+}
+
+func (s *fileStore) load(session, name string) (*v1.Span, error) {
+	_, span, err := s.read(session, name)
+	return span, err
+}
+
+func (s *fileStore) remove(session, name string) error {
+	if err := os.Remove(s.path(session, name)); errors.Is(err, fs.ErrNotExist) {
+		return errNoSpan
+	} else {
+		return err
+	}
+}
+
+// current returns the open span with the highest sequence number, removing
+// the expired ones on the way.
+func (s *fileStore) current(session string) (*v1.Span, error) {
+	entries, err := os.ReadDir(s.sessionDir(session))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNoSpan
+	} else if err != nil {
+		return nil, err
+	}
+	var (
+		latest *v1.Span
+		maxSeq uint64
+	)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), stateSpanSuffix) || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(entry.Name(), stateSpanSuffix))
+		if err != nil {
+			continue
+		}
+		if info, err := entry.Info(); err != nil {
+			continue
+		} else if s.ttl > 0 && time.Since(info.ModTime()) > s.ttl {
+			os.Remove(s.path(session, name))
+			continue
+		}
+		seq, span, err := s.read(session, name)
+		if errors.Is(err, errNoSpan) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if latest == nil || seq > maxSeq {
+			latest, maxSeq = span, seq
+		}
+	}
+	if latest == nil {
+		return nil, errNoSpan
+	}
+	return latest, nil
+}
+
+func (s *fileStore) addEvent(session, name string, event *v1.Span_Event) error {
+	seq, span, err := s.read(session, name)
+	if err != nil {
+		return err
+	}
+	span.Events = append(span.Events, event)
+	return s.write(session, name, seq, span)
+}
+
+// Start creates a new span and stores it as the open span called name. Its
+// parent defaults to the current open span of an explicit session.
+func Start(ctx context.Context, name string, cfg *SpanConfig) (*v1.Span, error) {
+	store, err := cfg.State.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.load(cfg.State.session(), name); err == nil {
+		return nil, fmt.Errorf("a span named %s is already open in session %s", name, cfg.State.session())
+	} else if !errors.Is(err, errNoSpan) {
+		return nil, err
+	}
+	if cfg.Name == "" {
+		cfg.Name = name
+	}
+	span, err := NewSpan(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return span, store.save(cfg.State.session(), name, span)
+}
+
+type EndConfig struct {
+	Span SpanConfig
+	Push PushConfig
+}
+
+// End closes the open span called name, updated from cfg.Span, and pushes it.
+// The span is only forgotten once pushed.
+func End(ctx context.Context, name string, cfg *EndConfig) (*v1.Span, error) {
+	base, err := cfg.Span.State.load(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Span.BaseSpan = base
+	span, err := NewSpan(ctx, &cfg.Span)
+	if err != nil {
+		return nil, err
+	}
+	if span.EndTimeUnixNano == 0 {
+		span.EndTimeUnixNano = uint64(time.Now().UnixNano())
+	}
+	cfg.Push.Spans = []*v1.Span{span}
+	// The parent was already resolved when the span was started.
+	cfg.Push.IgnoreEnv = true
+	if err = Push(ctx, &cfg.Push); err != nil {
+		return nil, err
+	}
+	store, err := cfg.Span.State.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return span, cfg.Span.State.wrap(name, store.remove(cfg.Span.State.session(), name))
+}
@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	v1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestFallbackStoreWriteThrough(t *testing.T) {
+	dir := t.TempDir()
+	primary := &fileStore{dir: filepath.Join(dir, "primary")}
+	fallback := &fileStore{dir: filepath.Join(dir, "fallback")}
+	store := &fallbackStore{primary, fallback}
+	if err := store.save("s", "build", &v1.Span{Name: "build"}); err != nil {
+		t.Fatal(err)
+	} else if err = store.addEvent("s", "build", &v1.Span_Event{Name: "event"}); err != nil {
+		t.Fatal(err)
+	}
+	// Losing the primary store, such as when the agent stops, keeps the
+	// span and its events.
+	if err := primary.remove("s", "build"); err != nil {
+		t.Fatal(err)
+	}
+	span, err := store.load("s", "build")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(span.Events) != 1 {
+		t.Fatalf("want 1 event, got %d", len(span.Events))
+	}
+	if err = store.remove("s", "build"); err != nil {
+		t.Fatal(err)
+	} else if _, err = fallback.load("s", "build"); !errors.Is(err, errNoSpan) {
+		t.Fatalf("want the span removed from the fallback store, got %v", err)
+	} else if err = store.remove("s", "build"); !errors.Is(err, errNoSpan) {
+		t.Fatalf("want %v, got %v", errNoSpan, err)
+	}
+}